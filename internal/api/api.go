@@ -1,19 +1,39 @@
 package api
 
 import (
-	"bytes"
-	"fmt"
-	"log/slog"
-	"net/http"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// HeaderNextCursor carries the cursor of the next page, so that list
+// endpoints can keep returning plain arrays.
+const HeaderNextCursor = "X-Next-Cursor"
+
+// HeaderTotalCount carries the number of items across all pages.
+const HeaderTotalCount = "X-Total-Count"
+
+// HeaderPartial marks a list that lacks items an upstream failed to return.
+const HeaderPartial = "X-Partial-Results"
+
 type ErrorResp struct {
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+// Warning names a section of a composed response that could not be filled.
+type Warning struct {
+	Section string `json:"section"`
 	Message string `json:"message"`
 }
 
+// NewWarning describes err with the same client-safe message ReturnError
+// would use.
+func NewWarning(section string, err error) Warning {
+	_, message := HTTPStatusFromError(err)
+	return Warning{Section: section, Message: message}
+}
+
 func InternalError(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResp{
 		Message: "Internal server error",
@@ -32,63 +52,39 @@ func Forbidden(c *fiber.Ctx) error {
 	})
 }
 
+func NotFound(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusNotFound).JSON(ErrorResp{
+		Message: "Not found",
+	})
+}
+
 func BadRequest(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusBadRequest).JSON(ErrorResp{
 		Message: "Bad request",
 	})
 }
 
-func ReturnError(c *fiber.Ctx, err error) error {
-	slog.Warn("Error in handling request",
-		"error", err,
-	)
-	return InternalError(c)
-}
-
-func ReturnResp(c *fiber.Ctx, resp *http.Response) error {
-	body := new(bytes.Buffer)
-	_, err := body.ReadFrom(resp.Body)
-	if err != nil {
-		slog.Warn("Error reading response body",
-			"error", err)
-		return ReturnError(c, err)
-	}
-	c.Set(fiber.HeaderContentType, resp.Header.Get(fiber.HeaderContentType))
-	return c.
-		Status(resp.StatusCode).
-		SendStream(body)
+func RequestEntityTooLarge(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(ErrorResp{
+		Message: "Request entity too large",
+	})
 }
 
-func RedirectRequest(url string, c *fiber.Ctx) (*http.Response, error) {
-	req, err := http.NewRequest(c.Method(), url, bytes.NewReader(c.Body()))
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
-	}
-
-	// Copy headers from the original request to the new request
-	for k, vs := range c.GetReqHeaders() {
-		for _, v := range vs {
-			req.Header.Add(k, v)
-		}
-	}
-
-	// Copy query parameters from the original request to the new request
-	q := req.URL.Query()
-	for k, v := range c.Queries() {
-		q.Add(k, v)
-	}
-
-	return http.DefaultClient.Do(req)
+// ValidationError is a 400 that tells the client which fields are invalid.
+func ValidationError(c *fiber.Ctx, errs []FieldError) error {
+	return c.Status(fiber.StatusBadRequest).JSON(ErrorResp{
+		Message: "Bad request",
+		Errors:  errs,
+	})
 }
 
-func HandleRedirect(url string, c *fiber.Ctx) error {
-	resp, err := RedirectRequest(url, c)
-	if err != nil {
-		return ReturnError(c, err)
-	}
-	defer resp.Body.Close()
-
-	return ReturnResp(c, resp)
+// ReturnError writes the HTTP response matching err. gRPC status errors are
+// translated to their HTTP counterpart, anything else is a 500.
+func ReturnError(c *fiber.Ctx, err error) error {
+	Logger(c).Warn("Error in handling request",
+		"error", err,
+	)
+	return returnStatusError(c, err)
 }
 
 func GetAuthToken(c *fiber.Ctx) string {
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/verify"
+)
+
+type claimsKey struct{}
+
+// SetClaims stores the verified claims of the caller on the request.
+func SetClaims(c *fiber.Ctx, claim verify.Claims) {
+	c.Locals(claimsKey{}, claim)
+}
+
+// GetClaims returns the claims stored by the auth middleware. The second
+// value is false for anonymous requests.
+func GetClaims(c *fiber.Ctx) (verify.Claims, bool) {
+	claim, ok := c.Locals(claimsKey{}).(verify.Claims)
+	return claim, ok
+}
+
+// MustGetClaims returns the claims of a route guarded by a policy that
+// requires a user. It panics if the route was registered without one.
+func MustGetClaims(c *fiber.Ctx) verify.Claims {
+	claim, ok := GetClaims(c)
+	if !ok {
+		panic("api: claims requested on a route without an authenticated policy")
+	}
+
+	return claim
+}
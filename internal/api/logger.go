@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeaderRequestID carries the request ID between the client, the gateway
+// and the upstreams.
+const HeaderRequestID = fiber.HeaderXRequestID
+
+type loggerKey struct{}
+
+type requestIDKey struct{}
+
+// SetLogger stores the request-scoped logger.
+func SetLogger(c *fiber.Ctx, logger *slog.Logger) {
+	c.Locals(loggerKey{}, logger)
+}
+
+// Logger returns the request-scoped logger, which carries the request ID,
+// or the default logger outside of a request.
+func Logger(c *fiber.Ctx) *slog.Logger {
+	if logger, ok := c.Locals(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the ID of the request ctx belongs to, or an
+// empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
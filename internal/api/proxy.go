@@ -0,0 +1,455 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/package/breaker"
+	"github.com/mummumgoodboy/gateway/package/retry"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrBadGateway wraps failures to reach an HTTP upstream.
+	ErrBadGateway = errors.New("bad gateway")
+	// ErrServiceUnavailable wraps calls rejected by the upstream's breaker.
+	ErrServiceUnavailable = errors.New("service unavailable")
+	// ErrBodyTooLarge is returned when a proxied request body exceeds the
+	// app's BodyLimit.
+	ErrBodyTooLarge = errors.New("request body too large")
+)
+
+// hopHeaders are meaningful for a single connection only and must not be
+// forwarded by proxies. See RFC 9110 section 7.6.1.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+var tracer = otel.Tracer("github.com/mummumgoodboy/gateway/internal/api")
+
+var (
+	upstreamRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_http_upstream_requests_total",
+		Help: "Number of requests proxied to HTTP upstreams.",
+	}, []string{"upstream", "method", "status"})
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_http_upstream_request_duration_seconds",
+		Help:    "Time until HTTP upstreams answered with response headers.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"upstream", "method", "status"})
+	upstreamRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_http_upstream_retries_total",
+		Help: "Number of requests resent to HTTP upstreams after a transient failure.",
+	}, []string{"upstream"})
+)
+
+// Proxy forwards requests to a single HTTP upstream using its own pooled
+// client.
+type Proxy struct {
+	name    string
+	client  *http.Client
+	timeout time.Duration
+	breaker *breaker.Breaker
+	retry   retry.Policy
+}
+
+// NewProxy creates a proxy to the upstream called name. Upstream calls,
+// including reading the response body, must complete within timeout. While
+// b is open, calls fail fast with ErrServiceUnavailable. Idempotent requests
+// are retried as rp describes.
+func NewProxy(name string, timeout time.Duration, b *breaker.Breaker, rp retry.Policy) *Proxy {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   32,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		// Pass the encoding negotiated by the client through untouched.
+		DisableCompression: true,
+	}
+
+	return &Proxy{
+		client: &http.Client{
+			Transport: transport,
+			// Redirects are the client's business, not ours.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		name:    name,
+		timeout: timeout,
+		breaker: b,
+		retry:   rp,
+	}
+}
+
+// RedirectRequest forwards the inbound request to target. The inbound query
+// string is merged into target, without overriding parameters target already
+// sets. GET and HEAD requests without a body are retried on transport errors
+// and on 502, 503 and 504 responses. The caller must close the response
+// body, which also ends the upstream span and releases the request deadline.
+func (p *Proxy) RedirectRequest(target string, c *fiber.Ctx) (*http.Response, error) {
+	return p.redirect(target, c, true)
+}
+
+// RedirectRequestExact is RedirectRequest without the inbound query string:
+// target is sent as is, for handlers that build and validate the upstream
+// query themselves.
+func (p *Proxy) RedirectRequestExact(target string, c *fiber.Ctx) (*http.Response, error) {
+	return p.redirect(target, c, false)
+}
+
+func (p *Proxy) redirect(target string, c *fiber.Ctx, merge bool) (*http.Response, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing upstream url: %w", err)
+	}
+	if merge {
+		mergeQuery(u, c)
+	}
+	limit := int64(c.App().Config().BodyLimit)
+	if requestContentLength(c) > limit {
+		// The rest of the body is still on the wire.
+		c.Context().SetConnectionClose()
+		return nil, ErrBodyTooLarge
+	}
+
+	resp, err := p.send(c.UserContext(), c.Method(), true, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, c.Method(), u.String(), requestBody(c, limit))
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = requestContentLength(c)
+		copyRequestHeaders(req, c)
+		setForwardedHeaders(req, c)
+		return req, nil
+	})
+	if errors.Is(err, ErrBodyTooLarge) {
+		c.Context().SetConnectionClose()
+	}
+	return resp, err
+}
+
+// Get sends a GET request of the gateway's own to target, with header added
+// and the same retries as RedirectRequest. Unlike proxied requests, it is
+// cancelled with ctx, so the caller must be done with the response body by
+// then and close it.
+func (p *Proxy) Get(ctx context.Context, target string, header http.Header) (*http.Response, error) {
+	return p.send(ctx, http.MethodGet, false, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, vs := range header {
+			for _, v := range vs {
+				req.Header.Add(k, v)
+			}
+		}
+		req.Header.Set(fiber.HeaderAccept, fiber.MIMEApplicationJSON)
+		return req, nil
+	})
+}
+
+type disconnectKey struct{}
+
+// ContextWithDisconnect returns a copy of ctx that carries gone, which is
+// done once the client has hung up. Detached upstream calls made with it are
+// cancelled then, even though they outlive ctx itself.
+func ContextWithDisconnect(ctx, gone context.Context) context.Context {
+	return context.WithValue(ctx, disconnectKey{}, gone)
+}
+
+func disconnectFromContext(ctx context.Context) context.Context {
+	if gone, ok := ctx.Value(disconnectKey{}).(context.Context); ok {
+		return gone
+	}
+	return context.Background()
+}
+
+// send makes the upstream call for parent with the request built by newReq.
+// A detached call outlives the cancellation of parent, though not its
+// deadline nor the client hanging up, for response bodies streamed after the
+// handler returns.
+func (p *Proxy) send(parent context.Context, method string, detached bool, newReq func(context.Context) (*http.Request, error)) (*http.Response, error) {
+	done, err := p.breaker.Allow()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrServiceUnavailable, p.name, err)
+	}
+
+	ctx, cancelDetached := parent, context.CancelFunc(func() {})
+	if detached {
+		if deadline, ok := parent.Deadline(); ok {
+			ctx, cancelDetached = context.WithDeadline(context.WithoutCancel(parent), deadline)
+		} else {
+			ctx, cancelDetached = context.WithCancel(context.WithoutCancel(parent))
+		}
+		stop := context.AfterFunc(disconnectFromContext(parent), cancelDetached)
+		cancel := cancelDetached
+		cancelDetached = func() {
+			stop()
+			cancel()
+		}
+	}
+	ctx, span := tracer.Start(ctx, "HTTP "+method+" "+p.name, trace.WithSpanKind(trace.SpanKindClient))
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	success := false
+	release := func() {
+		cancel()
+		cancelDetached()
+		span.End()
+		done(success)
+	}
+	span.SetAttributes(attribute.String("http.request.method", method))
+
+	req, err := newReq(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		release()
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	span.SetAttributes(attribute.String("url.full", req.URL.String()))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if id := RequestIDFromContext(ctx); id != "" {
+		req.Header.Set(HeaderRequestID, id)
+	}
+
+	// Only requests without a body can be sent again as they are.
+	retryable := (req.Method == http.MethodGet || req.Method == http.MethodHead) && req.ContentLength == 0
+
+	var resp *http.Response
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		resp, err = p.client.Do(req)
+		p.observe(req.Method, resp, time.Since(start))
+
+		if !retryable || attempt >= p.retry.MaxAttempts || !shouldRetry(resp, err) || !p.retry.Wait(ctx, attempt) {
+			break
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		upstreamRetries.WithLabelValues(p.name).Inc()
+		span.SetAttributes(attribute.Int("http.request.resend_count", attempt))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		// An oversized body is the client's fault, not the upstream's.
+		success = errors.Is(err, ErrBodyTooLarge)
+		release()
+		if errors.Is(err, context.DeadlineExceeded) || success {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", ErrBadGateway, err)
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	success = resp.StatusCode < http.StatusInternalServerError
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+
+	return resp, nil
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Proxy) observe(method string, resp *http.Response, elapsed time.Duration) {
+	class := "error"
+	if resp != nil {
+		class = strconv.Itoa(resp.StatusCode/100) + "xx"
+	}
+
+	upstreamRequests.WithLabelValues(p.name, method, class).Inc()
+	upstreamDuration.WithLabelValues(p.name, method, class).Observe(elapsed.Seconds())
+}
+
+// HandleRedirect proxies the request to target and streams the upstream
+// response back to the client.
+func (p *Proxy) HandleRedirect(target string, c *fiber.Ctx) error {
+	resp, err := p.RedirectRequest(target, c)
+	if err != nil {
+		return ReturnError(c, err)
+	}
+
+	return ReturnResp(c, resp)
+}
+
+// HandleRedirectExact is HandleRedirect without the inbound query string, see
+// RedirectRequestExact.
+func (p *Proxy) HandleRedirectExact(target string, c *fiber.Ctx) error {
+	resp, err := p.RedirectRequestExact(target, c)
+	if err != nil {
+		return ReturnError(c, err)
+	}
+
+	return ReturnResp(c, resp)
+}
+
+// ReturnResp streams resp back to the client. The body is closed once it has
+// been written out.
+func ReturnResp(c *fiber.Ctx, resp *http.Response) error {
+	removeHopHeaders(resp.Header)
+	for k, vs := range resp.Header {
+		if k == fiber.HeaderContentLength {
+			continue
+		}
+		for _, v := range vs {
+			c.Response().Header.Add(k, v)
+		}
+	}
+
+	c.Status(resp.StatusCode)
+	c.Context().SetBodyStream(resp.Body, int(resp.ContentLength))
+	return nil
+}
+
+// releaseOnClose ends the upstream call once the body has been consumed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// requestBody returns the inbound body. A streamed body fails with
+// ErrBodyTooLarge once it grows past limit, as fasthttp only enforces
+// BodyLimit on bodies it buffers.
+func requestBody(c *fiber.Ctx, limit int64) io.Reader {
+	if c.Request().IsBodyStream() {
+		return &limitedBody{r: c.Request().BodyStream(), left: limit}
+	}
+
+	body := c.Request().Body()
+	if len(body) == 0 {
+		return http.NoBody
+	}
+	return bytes.NewReader(body)
+}
+
+type limitedBody struct {
+	r    io.Reader
+	left int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	// Read one byte past the limit to tell an exact fit from an overflow.
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+	n, err := b.r.Read(p)
+	b.left -= int64(n)
+	if b.left < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func requestContentLength(c *fiber.Ctx) int64 {
+	if !c.Request().IsBodyStream() {
+		return int64(len(c.Request().Body()))
+	}
+
+	// Negative values are fasthttp's markers for chunked or unknown
+	// lengths, which net/http expresses as -1.
+	if l := c.Request().Header.ContentLength(); l >= 0 {
+		return int64(l)
+	}
+	return -1
+}
+
+func mergeQuery(u *url.URL, c *fiber.Ctx) {
+	own := u.Query()
+	q := u.Query()
+	c.Request().URI().QueryArgs().VisitAll(func(k, v []byte) {
+		key := string(k)
+		if _, ok := own[key]; ok {
+			return
+		}
+		q.Add(key, string(v))
+	})
+	u.RawQuery = q.Encode()
+}
+
+func copyRequestHeaders(req *http.Request, c *fiber.Ctx) {
+	c.Request().Header.VisitAll(func(k, v []byte) {
+		key := string(k)
+		switch textproto.CanonicalMIMEHeaderKey(key) {
+		case fiber.HeaderHost, fiber.HeaderContentLength:
+			return
+		}
+		req.Header.Add(key, string(v))
+	})
+	removeHopHeaders(req.Header)
+}
+
+func setForwardedHeaders(req *http.Request, c *fiber.Ctx) {
+	forwardedFor := c.IP()
+	if prior := req.Header.Values(fiber.HeaderXForwardedFor); len(prior) > 0 {
+		forwardedFor = strings.Join(prior, ", ") + ", " + forwardedFor
+	}
+	req.Header.Set(fiber.HeaderXForwardedFor, forwardedFor)
+	req.Header.Set(fiber.HeaderXForwardedProto, c.Protocol())
+	req.Header.Set(fiber.HeaderXForwardedHost, string(c.Request().Host()))
+}
+
+// removeHopHeaders drops hop-by-hop headers, including the ones named in the
+// Connection header.
+func removeHopHeaders(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StatusClientClosedRequest is the non-standard status used when the caller
+// went away before the upstream answered.
+const StatusClientClosedRequest = 499
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type httpStatus struct {
+	code    int
+	message string
+}
+
+// grpcStatusMap translates gRPC codes into the HTTP status and the message
+// that is safe to show to the client. Upstream messages are never forwarded
+// as they may leak implementation details.
+var grpcStatusMap = map[codes.Code]httpStatus{
+	codes.Canceled:           {StatusClientClosedRequest, "Request canceled"},
+	codes.InvalidArgument:    {fiber.StatusBadRequest, "Bad request"},
+	codes.OutOfRange:         {fiber.StatusBadRequest, "Bad request"},
+	codes.FailedPrecondition: {fiber.StatusBadRequest, "Bad request"},
+	codes.Unauthenticated:    {fiber.StatusUnauthorized, "Unauthorized"},
+	codes.PermissionDenied:   {fiber.StatusForbidden, "Forbidden"},
+	codes.NotFound:           {fiber.StatusNotFound, "Not found"},
+	codes.AlreadyExists:      {fiber.StatusConflict, "Conflict"},
+	codes.Aborted:            {fiber.StatusConflict, "Conflict"},
+	codes.ResourceExhausted:  {fiber.StatusTooManyRequests, "Too many requests"},
+	codes.Unimplemented:      {fiber.StatusNotImplemented, "Not implemented"},
+	codes.Unavailable:        {fiber.StatusServiceUnavailable, "Service unavailable"},
+	codes.DeadlineExceeded:   {fiber.StatusGatewayTimeout, "Upstream request timed out"},
+}
+
+// HTTPStatusFromError returns the HTTP status and client-safe message for
+// err. Unknown errors map to 500.
+func HTTPStatusFromError(err error) (int, string) {
+	switch {
+	case errors.Is(err, ErrBadGateway):
+		return fiber.StatusBadGateway, "Bad gateway"
+	case errors.Is(err, ErrBodyTooLarge):
+		return fiber.StatusRequestEntityTooLarge, "Request entity too large"
+	case errors.Is(err, ErrServiceUnavailable):
+		return fiber.StatusServiceUnavailable, "Service unavailable"
+	case errors.Is(err, context.DeadlineExceeded):
+		return fiber.StatusGatewayTimeout, "Upstream request timed out"
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest, "Request canceled"
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return fiber.StatusInternalServerError, "Internal server error"
+	}
+
+	if s, ok := grpcStatusMap[st.Code()]; ok {
+		return s.code, s.message
+	}
+
+	return fiber.StatusInternalServerError, "Internal server error"
+}
+
+// fieldErrorsFromStatus extracts field violations attached to a gRPC status
+// through the errdetails.BadRequest detail.
+func fieldErrorsFromStatus(st *status.Status) []FieldError {
+	var fieldErrors []FieldError
+	for _, detail := range st.Details() {
+		badRequest, ok := detail.(*errdetails.BadRequest)
+		if !ok {
+			continue
+		}
+
+		for _, v := range badRequest.GetFieldViolations() {
+			fieldErrors = append(fieldErrors, FieldError{
+				Field:   v.GetField(),
+				Message: v.GetDescription(),
+			})
+		}
+	}
+
+	return fieldErrors
+}
+
+// retryAfterFromStatus returns the delay advertised by the upstream through
+// the errdetails.RetryInfo detail, if any.
+func retryAfterFromStatus(st *status.Status) (time.Duration, bool) {
+	for _, detail := range st.Details() {
+		retryInfo, ok := detail.(*errdetails.RetryInfo)
+		if !ok || retryInfo.GetRetryDelay() == nil {
+			continue
+		}
+
+		return retryInfo.GetRetryDelay().AsDuration(), true
+	}
+
+	return 0, false
+}
+
+func returnStatusError(c *fiber.Ctx, err error) error {
+	code, message := HTTPStatusFromError(err)
+	if errors.Is(c.UserContext().Err(), context.DeadlineExceeded) {
+		// The whole request ran out of time, not just one upstream call.
+		code, message = fiber.StatusGatewayTimeout, "Request timed out"
+	}
+	resp := ErrorResp{Message: message}
+
+	if st, ok := status.FromError(err); ok {
+		if code == fiber.StatusBadRequest {
+			resp.Errors = fieldErrorsFromStatus(st)
+		}
+
+		if delay, ok := retryAfterFromStatus(st); ok {
+			seconds := int((delay + time.Second - 1) / time.Second)
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+		}
+	}
+
+	return c.Status(code).JSON(resp)
+}
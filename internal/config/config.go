@@ -1,12 +1,135 @@
 package config
 
+import "time"
+
 type Config struct {
+	ServerConfig    ServerConfig
+	LogConfig       LogConfig
+	TimeoutConfig   TimeoutConfig
+	BreakerConfig   BreakerConfig
+	RetryConfig     RetryConfig
+	EventsConfig    EventsConfig
+	SwipeConfig     SwipeConfig
+	FallbackConfig  FallbackConfig
+	CursorConfig    CursorConfig
+	RatingConfig    RatingConfig
+	ProfileConfig   ProfileConfig
 	AuthConfig      AuthConfig
 	FoodConfig      FoodConfig
 	RecommendConfig RecommendConfig
 	ReviewConfig    ReviewConfig
 	SearchConfig    SearchConfig
 	CORSConfig      CORSConfig
+	HealthConfig    HealthConfig
+	TracingConfig   TracingConfig
+}
+
+type ServerConfig struct {
+	// ShutdownTimeout is how long in-flight requests may take to drain once
+	// the gateway is asked to stop.
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"15s"`
+	// BodyLimit is the largest request body in bytes, proxied bodies
+	// included.
+	BodyLimit int `env:"BODY_LIMIT" envDefault:"4194304"`
+}
+
+type HealthConfig struct {
+	// CriticalDependencies lists the upstreams that must be up for the
+	// gateway to be ready. Any other upstream only marks it as degraded.
+	CriticalDependencies []string      `env:"HEALTH_CRITICAL_DEPENDENCIES" envDefault:"food,review,recommend,auth,search"`
+	CheckTimeout         time.Duration `env:"HEALTH_CHECK_TIMEOUT" envDefault:"2s"`
+}
+
+type TracingConfig struct {
+	// Exporter is one of "none", "otlp" or "file". Trace context is
+	// propagated to upstreams even when spans are not exported.
+	Exporter     string `env:"TRACING_EXPORTER" envDefault:"none"`
+	ServiceName  string `env:"TRACING_SERVICE_NAME" envDefault:"gateway"`
+	OTLPEndpoint string `env:"TRACING_OTLP_ENDPOINT" envDefault:"http://localhost:4318"`
+	FilePath     string `env:"TRACING_FILE_PATH" envDefault:"traces.jsonl"`
+}
+
+type LogConfig struct {
+	// Format is either "json" or "text".
+	Format string `env:"LOG_FORMAT" envDefault:"json"`
+}
+
+type TimeoutConfig struct {
+	// Request is the time budget of a request, upstream calls included.
+	Request time.Duration `env:"REQUEST_TIMEOUT" envDefault:"10s"`
+	// Routes overrides Request for some routes, keyed by method and route
+	// template, e.g. "GET /food-recommend/=3s,GET /food/:foodId=2s".
+	Routes map[string]time.Duration `env:"ROUTE_TIMEOUTS" envKeyValSeparator:"="`
+	// DisconnectPoll is how often a running request checks whether its
+	// client hung up; 0 turns the check off.
+	DisconnectPoll time.Duration `env:"DISCONNECT_POLL_INTERVAL" envDefault:"250ms"`
+}
+
+// BreakerConfig applies to the breaker of every upstream, each of which
+// tracks its own failures.
+type BreakerConfig struct {
+	Window           time.Duration `env:"BREAKER_WINDOW" envDefault:"30s"`
+	MinRequests      int           `env:"BREAKER_MIN_REQUESTS" envDefault:"20"`
+	FailureRate      float64       `env:"BREAKER_FAILURE_RATE" envDefault:"0.5"`
+	OpenTimeout      time.Duration `env:"BREAKER_OPEN_TIMEOUT" envDefault:"10s"`
+	HalfOpenRequests int           `env:"BREAKER_HALF_OPEN_REQUESTS" envDefault:"3"`
+	// MaxConcurrent caps in-flight calls per upstream.
+	MaxConcurrent int `env:"BULKHEAD_MAX_CONCURRENT" envDefault:"100"`
+}
+
+// RetryConfig applies to idempotent gRPC reads and proxied HTTP GETs.
+type RetryConfig struct {
+	// MaxAttempts counts the first call, so 1 disables retries.
+	MaxAttempts    int           `env:"RETRY_MAX_ATTEMPTS" envDefault:"3"`
+	InitialBackoff time.Duration `env:"RETRY_INITIAL_BACKOFF" envDefault:"50ms"`
+	MaxBackoff     time.Duration `env:"RETRY_MAX_BACKOFF" envDefault:"1s"`
+	Multiplier     float64       `env:"RETRY_BACKOFF_MULTIPLIER" envDefault:"2"`
+	Jitter         float64       `env:"RETRY_JITTER" envDefault:"0.2"`
+}
+
+// EventsConfig sizes the queue of events sent to the recommender.
+type EventsConfig struct {
+	QueueSize int `env:"EVENTS_QUEUE_SIZE" envDefault:"1024"`
+	Workers   int `env:"EVENTS_WORKERS" envDefault:"4"`
+}
+
+type SwipeConfig struct {
+	// SessionTTL is how long a swipe session is kept after its last use.
+	SessionTTL time.Duration `env:"SWIPE_SESSION_TTL" envDefault:"30m"`
+}
+
+// FallbackConfig tunes the popularity ranking served while the recommender
+// is unavailable.
+type FallbackConfig struct {
+	// HalfLife is how long it takes for a recommendation or rating to lose
+	// half of its weight.
+	HalfLife time.Duration `env:"FALLBACK_HALF_LIFE" envDefault:"24h"`
+	MaxItems int           `env:"FALLBACK_MAX_ITEMS" envDefault:"5000"`
+	// SeedTimeout bounds loading recent ratings at startup; 0 skips it.
+	SeedTimeout time.Duration `env:"FALLBACK_SEED_TIMEOUT" envDefault:"1m"`
+}
+
+type CursorConfig struct {
+	// Secret signs pagination cursors. Replicas must share it; when empty a
+	// random one is picked at startup.
+	Secret string `env:"CURSOR_SECRET"`
+}
+
+type RatingConfig struct {
+	// CacheTTL bounds how stale a rating summary can be when reviews change
+	// through another replica.
+	CacheTTL        time.Duration `env:"RATING_CACHE_TTL" envDefault:"5m"`
+	CacheMaxEntries int           `env:"RATING_CACHE_MAX_ENTRIES" envDefault:"10000"`
+}
+
+// ProfileConfig tunes the cache of public user profiles fetched from the auth
+// service.
+type ProfileConfig struct {
+	// Enabled turns on reviewer profile lookups, which also need
+	// AuthConfig.ServiceToken.
+	Enabled         bool          `env:"PROFILE_ENABLED" envDefault:"true"`
+	CacheTTL        time.Duration `env:"PROFILE_CACHE_TTL" envDefault:"1m"`
+	CacheMaxEntries int           `env:"PROFILE_CACHE_MAX_ENTRIES" envDefault:"10000"`
 }
 
 type CORSConfig struct {
@@ -16,20 +139,46 @@ type CORSConfig struct {
 type AuthConfig struct {
 	Key            string `env:"AUTH_KEY"`
 	AuthServiceURL string `env:"AUTH_SERVICE_URL"`
+	// AuthServiceTimeout bounds a proxied call, including the response body.
+	AuthServiceTimeout time.Duration `env:"AUTH_SERVICE_TIMEOUT" envDefault:"10s"`
+	// ServiceToken authenticates the gateway's own calls to the auth
+	// service, such as profile lookups, which are skipped without it.
+	ServiceToken string `env:"AUTH_SERVICE_TOKEN"`
 }
 
 type FoodConfig struct {
 	FoodServiceAddr string `env:"FOOD_SERVICE_ADDR"`
+	// FoodServiceTimeout bounds a single call to the service.
+	FoodServiceTimeout time.Duration `env:"FOOD_SERVICE_TIMEOUT" envDefault:"5s"`
 }
 
 type RecommendConfig struct {
 	RecommendServiceAddr string `env:"RECOMMENDATION_SERVICE_ADDR"`
+	// RecommendServiceTimeout bounds a single call to the service.
+	RecommendServiceTimeout time.Duration `env:"RECOMMENDATION_SERVICE_TIMEOUT" envDefault:"5s"`
+	// SnapshotSize is how many recommendations are ranked up front and
+	// paged through with a cursor.
+	SnapshotSize int `env:"RECOMMENDATION_SNAPSHOT_SIZE" envDefault:"200"`
+	// RestaurantDepth is how many recommended foods restaurants are ranked
+	// by.
+	RestaurantDepth int `env:"RECOMMENDATION_RESTAURANT_DEPTH" envDefault:"200"`
+	// CursorTTL is how long a snapshot and its cursors stay valid.
+	CursorTTL time.Duration `env:"RECOMMENDATION_CURSOR_TTL" envDefault:"15m"`
+	// ShareTTL is how long a token sharing a user's tastes with a group
+	// stays valid.
+	ShareTTL time.Duration `env:"RECOMMENDATION_SHARE_TTL" envDefault:"24h"`
 }
 
 type ReviewConfig struct {
 	ReviewServiceAddr string `env:"REVIEW_SERVICE_ADDR"`
+	// ReviewServiceTimeout bounds a single call to the service.
+	ReviewServiceTimeout time.Duration `env:"REVIEW_SERVICE_TIMEOUT" envDefault:"5s"`
+	// CursorTTL is how long a cursor paging through reviews stays valid.
+	CursorTTL time.Duration `env:"REVIEW_CURSOR_TTL" envDefault:"1h"`
 }
 
 type SearchConfig struct {
 	SearchServiceAddr string `env:"SEARCH_SERVICE_ADDR"`
+	// SearchServiceTimeout bounds a proxied call, including the response body.
+	SearchServiceTimeout time.Duration `env:"SEARCH_SERVICE_TIMEOUT" envDefault:"10s"`
 }
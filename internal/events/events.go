@@ -0,0 +1,142 @@
+// Package events forwards user behaviour to the recommender without holding
+// up the requests that caused it.
+package events
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"github.com/mummumgoodboy/gateway/internal/config"
+	"github.com/mummumgoodboy/gateway/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var eventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_recommender_events_total",
+	Help: "Number of recommender events by outcome: sent, failed or dropped.",
+}, []string{"type", "op", "result"})
+
+type Event struct {
+	Type   proto.EventType
+	UserID int64
+	ItemID string
+	// Remove retracts an earlier event of the same type instead of adding
+	// one.
+	Remove bool
+}
+
+func (e Event) labels(result string) []string {
+	op := "add"
+	if e.Remove {
+		op = "remove"
+	}
+	return []string{strings.ToLower(e.Type.String()), op, result}
+}
+
+type queued struct {
+	ctx   context.Context
+	event Event
+}
+
+// Emitter sends events from a bounded queue drained by a fixed number of
+// workers. Events that do not fit in the queue are dropped.
+type Emitter struct {
+	recommendService proto.RecommendServiceClient
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan queued
+	wg     sync.WaitGroup
+}
+
+func NewEmitter(cfg config.EventsConfig, recommendService proto.RecommendServiceClient) *Emitter {
+	e := &Emitter{
+		recommendService: recommendService,
+		queue:            make(chan queued, cfg.QueueSize),
+	}
+	for range max(cfg.Workers, 1) {
+		e.wg.Add(1)
+		go e.run()
+	}
+
+	return e
+}
+
+// Emit queues ev without blocking. ctx only lends its trace and request ID to
+// the upstream call; its cancellation is ignored.
+func (e *Emitter) Emit(ctx context.Context, ev Event) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		eventsTotal.WithLabelValues(ev.labels("dropped")...).Inc()
+		return
+	}
+
+	select {
+	case e.queue <- queued{ctx: context.WithoutCancel(ctx), event: ev}:
+	default:
+		eventsTotal.WithLabelValues(ev.labels("dropped")...).Inc()
+	}
+}
+
+func (e *Emitter) run() {
+	defer e.wg.Done()
+
+	for q := range e.queue {
+		ev := q.event
+		var err error
+		if ev.Remove {
+			_, err = e.recommendService.RemoveEvent(q.ctx, &proto.RemoveEventReq{
+				EventType: ev.Type,
+				UserId:    ev.UserID,
+				ItemId:    ev.ItemID,
+			})
+		} else {
+			_, err = e.recommendService.AddEvent(q.ctx, &proto.AddEventReq{
+				EventType: ev.Type,
+				UserId:    ev.UserID,
+				ItemId:    ev.ItemID,
+			})
+		}
+
+		if err != nil {
+			eventsTotal.WithLabelValues(ev.labels("failed")...).Inc()
+			slog.Warn("Failed to send recommender event",
+				"error", err,
+				"request_id", api.RequestIDFromContext(q.ctx),
+				"type", ev.Type.String(),
+				"user_id", ev.UserID,
+				"item_id", ev.ItemID,
+			)
+			continue
+		}
+		eventsTotal.WithLabelValues(ev.labels("sent")...).Inc()
+	}
+}
+
+// Shutdown stops accepting events and waits for the queued ones to be sent.
+func (e *Emitter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -8,29 +8,30 @@ import (
 
 // Act as a gateway to the auth service
 type AuthHandler struct {
-	cfg *config.Config
+	cfg   *config.Config
+	proxy *api.Proxy
 }
 
-func NewAuthHandler(cfg *config.Config) *AuthHandler {
-	return &AuthHandler{cfg: cfg}
+func NewAuthHandler(cfg *config.Config, proxy *api.Proxy) *AuthHandler {
+	return &AuthHandler{cfg: cfg, proxy: proxy}
 }
 
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
-	return api.HandleRedirect(h.cfg.AuthConfig.AuthServiceURL+"/auth/login", c)
+	return h.proxy.HandleRedirect(h.cfg.AuthConfig.AuthServiceURL+"/auth/login", c)
 }
 
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
-	return api.HandleRedirect(h.cfg.AuthConfig.AuthServiceURL+"/auth/register", c)
+	return h.proxy.HandleRedirect(h.cfg.AuthConfig.AuthServiceURL+"/auth/register", c)
 }
 
 func (h *AuthHandler) GetMe(c *fiber.Ctx) error {
-	return api.HandleRedirect(h.cfg.AuthConfig.AuthServiceURL+"/me", c)
+	return h.proxy.HandleRedirect(h.cfg.AuthConfig.AuthServiceURL+"/me", c)
 }
 
 func (h *AuthHandler) UpdateProfile(c *fiber.Ctx) error {
-	return api.HandleRedirect(h.cfg.AuthConfig.AuthServiceURL+"/me", c)
+	return h.proxy.HandleRedirect(h.cfg.AuthConfig.AuthServiceURL+"/me", c)
 }
 
 func (h *AuthHandler) ChangePassword(c *fiber.Ctx) error {
-	return api.HandleRedirect(h.cfg.AuthConfig.AuthServiceURL+"/me/password", c)
+	return h.proxy.HandleRedirect(h.cfg.AuthConfig.AuthServiceURL+"/me/password", c)
 }
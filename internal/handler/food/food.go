@@ -1,62 +1,77 @@
 package food
 
 import (
-	"log/slog"
-
 	"github.com/gofiber/fiber/v2"
 	"github.com/mummumgoodboy/gateway/internal/api"
 	"github.com/mummumgoodboy/gateway/internal/config"
+	"github.com/mummumgoodboy/gateway/internal/events"
+	"github.com/mummumgoodboy/gateway/internal/rating"
 	"github.com/mummumgoodboy/gateway/proto"
-	"github.com/mummumgoodboy/verify"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 type FoodHandler struct {
 	cfg *config.Config
 
-	foodService proto.RestaurantFoodClient
-	verify      *verify.JWTVerifier
+	foodService   proto.RestaurantFoodClient
+	reviewService proto.ReviewClient
+	events        *events.Emitter
+	ratings       *rating.Service
 }
 
-func NewFoodHandler(cfg *config.Config, foodService proto.RestaurantFoodClient, verifier *verify.JWTVerifier) *FoodHandler {
-	return &FoodHandler{cfg: cfg, foodService: foodService, verify: verifier}
+func NewFoodHandler(cfg *config.Config, foodService proto.RestaurantFoodClient, reviewService proto.ReviewClient, emitter *events.Emitter, ratings *rating.Service) *FoodHandler {
+	return &FoodHandler{cfg: cfg, foodService: foodService, reviewService: reviewService, events: emitter, ratings: ratings}
 }
 
+// GetFood returns a food, expanded with the sections listed in ?include=.
+// Views by logged-in users are reported to the recommender.
 func (h *FoodHandler) GetFood(c *fiber.Ctx) error {
-	food, err := h.foodService.GetFoodByFoodId(c.Context(), &proto.FoodIdRequest{
-		Id: c.Params("foodId"),
-	})
+	inc, errs := parseIncludes(c)
+	if len(errs) > 0 {
+		return api.ValidationError(c, errs)
+	}
+
+	var (
+		resp any
+		food *proto.Food
+		err  error
+	)
+	if inc == (includes{}) {
+		food, err = h.foodService.GetFoodByFoodId(c.UserContext(), &proto.FoodIdRequest{
+			Id: c.Params("foodId"),
+		})
+		resp = food
+	} else {
+		var detail *FoodDetailResp
+		detail, err = h.getFoodDetail(c, c.Params("foodId"), inc)
+		if err == nil {
+			food, resp = detail.Food, detail
+		}
+	}
 	if err != nil {
 		return api.ReturnError(c, err)
 	}
 
-	return c.JSON(food)
-}
-
-func (h *FoodHandler) CreateFood(c *fiber.Ctx) error {
-	claim, err := h.verify.Verify(api.GetAuthToken(c))
-	if err != nil {
-		slog.Warn("Failed to verify token",
-			"error", err,
-		)
-		return api.Unauthorized(c)
+	if claim, ok := api.GetClaims(c); ok {
+		h.events.Emit(c.UserContext(), events.Event{
+			Type:   proto.EventType_VIEW,
+			UserID: int64(claim.UserId),
+			ItemID: food.Id,
+		})
 	}
 
-	if !claim.IsAdmin {
-		slog.Warn("User is not admin",
-			"user", claim.UserId,
-		)
-		return api.Forbidden(c)
-	}
+	return c.JSON(resp)
+}
 
+func (h *FoodHandler) CreateFood(c *fiber.Ctx) error {
 	food := new(proto.Food)
 	if err := c.BodyParser(food); err != nil {
-		slog.Warn("Failed to parse body",
+		api.Logger(c).Warn("Failed to parse body",
 			"error", err)
 		return api.BadRequest(c)
 	}
 
-	food, err = h.foodService.CreateFood(c.Context(), &proto.Food{
+	food, err := h.foodService.CreateFood(c.UserContext(), &proto.Food{
 		Name:         food.Name,
 		Description:  food.Description,
 		Price:        food.Price,
@@ -65,7 +80,7 @@ func (h *FoodHandler) CreateFood(c *fiber.Ctx) error {
 	})
 
 	if err != nil {
-		slog.Warn("Failed to create food",
+		api.Logger(c).Warn("Failed to create food",
 			"error", err)
 		return api.ReturnError(c, err)
 	}
@@ -74,33 +89,18 @@ func (h *FoodHandler) CreateFood(c *fiber.Ctx) error {
 }
 
 func (h *FoodHandler) UpdateFood(c *fiber.Ctx) error {
-	claim, err := h.verify.Verify(api.GetAuthToken(c))
-	if err != nil {
-		slog.Warn("Failed to verify token",
-			"error", err,
-		)
-		return api.Unauthorized(c)
-	}
-
-	if !claim.IsAdmin {
-		slog.Warn("User is not admin",
-			"user", claim.UserId,
-		)
-		return api.Forbidden(c)
-	}
-
 	food := new(proto.Food)
 	if err := c.BodyParser(food); err != nil {
-		slog.Warn("Failed to parse body",
+		api.Logger(c).Warn("Failed to parse body",
 			"error", err)
 		return api.BadRequest(c)
 	}
 
 	food.Id = c.Params("foodId")
 
-	food, err = h.foodService.UpdateFood(c.Context(), food)
+	food, err := h.foodService.UpdateFood(c.UserContext(), food)
 	if err != nil {
-		slog.Warn("Failed to update food",
+		api.Logger(c).Warn("Failed to update food",
 			"error", err)
 		return api.ReturnError(c, err)
 	}
@@ -109,26 +109,11 @@ func (h *FoodHandler) UpdateFood(c *fiber.Ctx) error {
 }
 
 func (h *FoodHandler) DeleteFood(c *fiber.Ctx) error {
-	claim, err := h.verify.Verify(api.GetAuthToken(c))
-	if err != nil {
-		slog.Warn("Failed to verify token",
-			"error", err,
-		)
-		return api.Unauthorized(c)
-	}
-
-	if !claim.IsAdmin {
-		slog.Warn("User is not admin",
-			"user", claim.UserId,
-		)
-		return api.Forbidden(c)
-	}
-
-	_, err = h.foodService.DeleteFood(c.Context(), &proto.FoodIdRequest{
+	_, err := h.foodService.DeleteFood(c.UserContext(), &proto.FoodIdRequest{
 		Id: c.Params("foodId"),
 	})
 	if err != nil {
-		slog.Warn("Failed to delete food",
+		api.Logger(c).Warn("Failed to delete food",
 			"error", err)
 		return api.ReturnError(c, err)
 	}
@@ -137,7 +122,7 @@ func (h *FoodHandler) DeleteFood(c *fiber.Ctx) error {
 }
 
 func (h *FoodHandler) GetFoodsByRestaurantId(c *fiber.Ctx) error {
-	foods, err := h.foodService.GetFoodsByRestaurantId(c.Context(), &proto.RestaurantIdRequest{
+	foods, err := h.foodService.GetFoodsByRestaurantId(c.UserContext(), &proto.RestaurantIdRequest{
 		Id: c.Params("restaurantId"),
 	})
 	if err != nil {
@@ -148,7 +133,7 @@ func (h *FoodHandler) GetFoodsByRestaurantId(c *fiber.Ctx) error {
 }
 
 func (h *FoodHandler) GetRestaurants(c *fiber.Ctx) error {
-	restaurants, err := h.foodService.GetRestaurants(c.Context(), &emptypb.Empty{})
+	restaurants, err := h.foodService.GetRestaurants(c.UserContext(), &emptypb.Empty{})
 	if err != nil {
 		return api.ReturnError(c, err)
 	}
@@ -157,7 +142,7 @@ func (h *FoodHandler) GetRestaurants(c *fiber.Ctx) error {
 }
 
 func (h *FoodHandler) GetRestaurant(c *fiber.Ctx) error {
-	restaurant, err := h.foodService.GetRestaurantByRestaurantId(c.Context(), &proto.RestaurantIdRequest{
+	restaurant, err := h.foodService.GetRestaurantByRestaurantId(c.UserContext(), &proto.RestaurantIdRequest{
 		Id: c.Params("restaurantId"),
 	})
 	if err != nil {
@@ -168,31 +153,16 @@ func (h *FoodHandler) GetRestaurant(c *fiber.Ctx) error {
 }
 
 func (h *FoodHandler) CreateRestaurant(c *fiber.Ctx) error {
-	claim, err := h.verify.Verify(api.GetAuthToken(c))
-	if err != nil {
-		slog.Warn("Failed to verify token",
-			"error", err,
-		)
-		return api.Unauthorized(c)
-	}
-
-	if !claim.IsAdmin {
-		slog.Warn("User is not admin",
-			"user", claim.UserId,
-		)
-		return api.Forbidden(c)
-	}
-
 	req := new(proto.CreateRestaurantRequest)
 	if err := c.BodyParser(req); err != nil {
-		slog.Warn("Failed to parse body",
+		api.Logger(c).Warn("Failed to parse body",
 			"error", err)
 		return api.BadRequest(c)
 	}
 
-	restaurant, err := h.foodService.CreateRestaurant(c.Context(), req)
+	restaurant, err := h.foodService.CreateRestaurant(c.UserContext(), req)
 	if err != nil {
-		slog.Warn("Failed to create restaurant",
+		api.Logger(c).Warn("Failed to create restaurant",
 			"error", err)
 		return api.ReturnError(c, err)
 	}
@@ -201,32 +171,17 @@ func (h *FoodHandler) CreateRestaurant(c *fiber.Ctx) error {
 }
 
 func (h *FoodHandler) UpdateRestaurant(c *fiber.Ctx) error {
-	claim, err := h.verify.Verify(api.GetAuthToken(c))
-	if err != nil {
-		slog.Warn("Failed to verify token",
-			"error", err,
-		)
-		return api.Unauthorized(c)
-	}
-
-	if !claim.IsAdmin {
-		slog.Warn("User is not admin",
-			"user", claim.UserId,
-		)
-		return api.Forbidden(c)
-	}
-
 	req := new(proto.Restaurant)
 	if err := c.BodyParser(req); err != nil {
-		slog.Warn("Failed to parse body",
+		api.Logger(c).Warn("Failed to parse body",
 			"error", err)
 	}
 
 	req.Id = c.Params("restaurantId")
 
-	restaurant, err := h.foodService.UpdateRestaurants(c.Context(), req)
+	restaurant, err := h.foodService.UpdateRestaurants(c.UserContext(), req)
 	if err != nil {
-		slog.Warn("Failed to update restaurant",
+		api.Logger(c).Warn("Failed to update restaurant",
 			"error", err)
 		return api.ReturnError(c, err)
 	}
@@ -235,26 +190,11 @@ func (h *FoodHandler) UpdateRestaurant(c *fiber.Ctx) error {
 }
 
 func (h *FoodHandler) DeleteRestaurant(c *fiber.Ctx) error {
-	claim, err := h.verify.Verify(api.GetAuthToken(c))
-	if err != nil {
-		slog.Warn("Failed to verify token",
-			"error", err,
-		)
-		return api.Unauthorized(c)
-	}
-
-	if !claim.IsAdmin {
-		slog.Warn("User is not admin",
-			"user", claim.UserId,
-		)
-		return api.Forbidden(c)
-	}
-
-	_, err = h.foodService.DeleteRestaurant(c.Context(), &proto.RestaurantIdRequest{
+	_, err := h.foodService.DeleteRestaurant(c.UserContext(), &proto.RestaurantIdRequest{
 		Id: c.Params("restaurantId"),
 	})
 	if err != nil {
-		slog.Warn("Failed to delete restaurant",
+		api.Logger(c).Warn("Failed to delete restaurant",
 			"error", err)
 		return api.ReturnError(c, err)
 	}
@@ -0,0 +1,163 @@
+package food
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"github.com/mummumgoodboy/gateway/internal/rating"
+	"github.com/mummumgoodboy/gateway/proto"
+)
+
+// includes are the sections a client may add to a food with ?include=.
+type includes struct {
+	restaurant bool
+	rating     bool
+	favorite   bool
+	reviews    bool
+}
+
+func parseIncludes(c *fiber.Ctx) (includes, []api.FieldError) {
+	var (
+		inc  includes
+		errs []api.FieldError
+	)
+
+	for _, v := range strings.Split(c.Query("include"), ",") {
+		v = strings.TrimSpace(v)
+		switch v {
+		case "":
+		case "restaurant":
+			inc.restaurant = true
+		case "rating":
+			inc.rating = true
+		case "favorite":
+			inc.favorite = true
+		case "reviews":
+			inc.reviews = true
+		default:
+			errs = append(errs, api.FieldError{
+				Field:   "include",
+				Message: fmt.Sprintf("unknown section %q, expected restaurant, rating, favorite or reviews", v),
+			})
+		}
+	}
+
+	return inc, errs
+}
+
+// FoodDetailResp is a food with the sections the client asked for. Sections
+// listed in Warnings are left out.
+type FoodDetailResp struct {
+	*proto.Food
+	Restaurant *proto.Restaurant       `json:"restaurant,omitempty"`
+	Rating     *rating.Summary         `json:"rating,omitempty"`
+	Reviews    []*proto.ReviewResponse `json:"reviews,omitempty"`
+	// IsFavorite is only set for logged-in users.
+	IsFavorite *bool         `json:"is_favorite,omitempty"`
+	Warnings   []api.Warning `json:"warnings,omitempty"`
+}
+
+// getFoodDetail fetches the food and the sections in inc concurrently. Only
+// the food itself is required.
+func (h *FoodHandler) getFoodDetail(c *fiber.Ctx, foodId string, inc includes) (*FoodDetailResp, error) {
+	claim, loggedIn := api.GetClaims(c)
+
+	var (
+		wg         sync.WaitGroup
+		resp       FoodDetailResp
+		foodErr    error
+		restErr    error
+		summary    rating.Summary
+		reviews    []*proto.ReviewResponse
+		reviewsErr error
+		favorites  []*proto.FavoriteFoodResponse
+		favErr     error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		resp.Food, foodErr = h.foodService.GetFoodByFoodId(c.UserContext(), &proto.FoodIdRequest{
+			Id: foodId,
+		})
+		if foodErr != nil || !inc.restaurant {
+			return
+		}
+		resp.Restaurant, restErr = h.foodService.GetRestaurantByRestaurantId(c.UserContext(), &proto.RestaurantIdRequest{
+			Id: resp.Food.RestaurantId,
+		})
+	}()
+	if inc.rating || inc.reviews {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// The rating alone can come from the cache, but reviews are
+			// always fetched.
+			if inc.reviews {
+				summary, reviews, reviewsErr = h.ratings.FoodReviews(c.UserContext(), foodId)
+			} else {
+				summary, reviewsErr = h.ratings.Food(c.UserContext(), foodId)
+			}
+		}()
+	}
+	if inc.favorite && loggedIn {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var res *proto.GetFavoriteFoodsByUserIDResponse
+			res, favErr = h.reviewService.GetFavoriteFoodsByUserId(c.UserContext(), &proto.GetFavoriteFoodsByUserIDRequest{
+				UserId: int32(claim.UserId),
+			})
+			favorites = res.GetFavoriteFoods()
+		}()
+	}
+	wg.Wait()
+
+	if foodErr != nil {
+		return nil, foodErr
+	}
+
+	if restErr != nil {
+		api.Logger(c).Warn("Failed to get restaurant", "error", restErr)
+		resp.Restaurant = nil
+		resp.Warnings = append(resp.Warnings, api.NewWarning("restaurant", restErr))
+	}
+
+	if reviewsErr != nil {
+		api.Logger(c).Warn("Failed to retrieve reviews", "error", reviewsErr)
+		if inc.rating {
+			resp.Warnings = append(resp.Warnings, api.NewWarning("rating", reviewsErr))
+		}
+		if inc.reviews {
+			resp.Warnings = append(resp.Warnings, api.NewWarning("reviews", reviewsErr))
+		}
+	} else {
+		if inc.rating {
+			resp.Rating = &summary
+		}
+		if inc.reviews {
+			resp.Reviews = reviews
+			if resp.Reviews == nil {
+				resp.Reviews = []*proto.ReviewResponse{}
+			}
+		}
+	}
+
+	if favErr != nil {
+		api.Logger(c).Warn("Failed to retrieve favorite foods", "error", favErr)
+		resp.Warnings = append(resp.Warnings, api.NewWarning("favorite", favErr))
+	} else if inc.favorite && loggedIn {
+		isFavorite := false
+		for _, f := range favorites {
+			if f.FoodId == foodId {
+				isFavorite = true
+				break
+			}
+		}
+		resp.IsFavorite = &isFavorite
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,195 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"github.com/mummumgoodboy/gateway/internal/config"
+	"github.com/mummumgoodboy/gateway/package/breaker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Dependency is an upstream checked by the readiness probe.
+type Dependency struct {
+	Name    string
+	Check   func(ctx context.Context) DependencyStatus
+	Breaker *breaker.Breaker
+}
+
+type DependencyStatus struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	// State is the gRPC connectivity state, empty for HTTP upstreams.
+	State   string `json:"state,omitempty"`
+	Breaker string `json:"breaker,omitempty"`
+	// Reason is a short code for why the dependency is down. The probe is
+	// public, so the error itself, which may name internal addresses, is
+	// only logged.
+	Reason string `json:"reason,omitempty"`
+	err    error
+}
+
+type ReadinessResp struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+type HealthHandler struct {
+	cfg *config.Config
+
+	dependencies []Dependency
+}
+
+func NewHealthHandler(cfg *config.Config, dependencies ...Dependency) *HealthHandler {
+	return &HealthHandler{cfg: cfg, dependencies: dependencies}
+}
+
+// GRPCDependency checks the connectivity state of conn and, when the
+// upstream implements it, the gRPC health protocol. The state of b, the
+// breaker guarding the upstream, is reported alongside.
+func GRPCDependency(name string, conn *grpc.ClientConn, b *breaker.Breaker) Dependency {
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	return Dependency{
+		Name:    name,
+		Breaker: b,
+		Check: func(ctx context.Context) DependencyStatus {
+			state := conn.GetState()
+			if state == connectivity.Idle {
+				conn.Connect()
+			}
+
+			res := DependencyStatus{State: state.String()}
+			if state == connectivity.Shutdown {
+				res.Status = StatusDown
+				res.Reason = "shutdown"
+				return res
+			}
+
+			resp, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+			switch {
+			case status.Code(err) == codes.Unimplemented:
+				// The upstream does not speak the health protocol, so
+				// being able to reach it is all we can tell.
+				res.Status = StatusUp
+			case err != nil:
+				res.Status = StatusDown
+				res.Reason = status.Code(err).String()
+				res.err = err
+			case resp.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING:
+				res.Status = StatusDown
+				res.Reason = resp.GetStatus().String()
+			default:
+				res.Status = StatusUp
+			}
+			res.State = conn.GetState().String()
+
+			return res
+		},
+	}
+}
+
+// HTTPDependency sends a GET to url. Any response below 500 means the
+// upstream is up.
+func HTTPDependency(name string, url string, b *breaker.Breaker) Dependency {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return Dependency{
+		Name:    name,
+		Breaker: b,
+		Check: func(ctx context.Context) DependencyStatus {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return DependencyStatus{Status: StatusDown, Reason: "invalid_url", err: err}
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				return DependencyStatus{Status: StatusDown, Reason: "unreachable", err: err}
+			}
+			defer resp.Body.Close()
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+			if resp.StatusCode >= http.StatusInternalServerError {
+				return DependencyStatus{Status: StatusDown, Reason: fmt.Sprintf("status %d", resp.StatusCode)}
+			}
+
+			return DependencyStatus{Status: StatusUp}
+		},
+	}
+}
+
+// Liveness only tells the orchestrator that the process is serving.
+func (h *HealthHandler) Liveness(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status": "ok",
+	})
+}
+
+// Readiness checks every dependency concurrently. The gateway is ready when
+// all critical dependencies are up; failing optional ones only degrade it.
+func (h *HealthHandler) Readiness(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.HealthConfig.CheckTimeout)
+	defer cancel()
+
+	results := make([]DependencyStatus, len(h.dependencies))
+	var wg sync.WaitGroup
+	for i, dep := range h.dependencies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = dep.Check(ctx)
+		}()
+	}
+	wg.Wait()
+
+	resp := ReadinessResp{
+		Status:       "ok",
+		Dependencies: make(map[string]DependencyStatus, len(h.dependencies)),
+	}
+	code := fiber.StatusOK
+	for i, dep := range h.dependencies {
+		res := results[i]
+		res.Critical = slices.Contains(h.cfg.HealthConfig.CriticalDependencies, dep.Name)
+		if dep.Breaker != nil {
+			res.Breaker = dep.Breaker.State().String()
+		}
+		resp.Dependencies[dep.Name] = res
+
+		if res.Status == StatusUp {
+			continue
+		}
+		api.Logger(c).Warn("Dependency is down",
+			"dependency", dep.Name,
+			"reason", res.Reason,
+			"error", res.err,
+		)
+		if res.Critical {
+			resp.Status = "unavailable"
+			code = fiber.StatusServiceUnavailable
+		} else if resp.Status == "ok" {
+			resp.Status = "degraded"
+		}
+	}
+
+	return c.Status(code).JSON(resp)
+}
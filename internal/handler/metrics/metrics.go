@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Expose metrics in the Prometheus exposition format
+type MetricsHandler struct {
+	handler fiber.Handler
+}
+
+func NewMetricsHandler(gatherer prometheus.Gatherer) *MetricsHandler {
+	return &MetricsHandler{
+		handler: adaptor.HTTPHandler(promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})),
+	}
+}
+
+func (h *MetricsHandler) GetMetrics(c *fiber.Ctx) error {
+	return h.handler(c)
+}
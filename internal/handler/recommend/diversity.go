@@ -0,0 +1,70 @@
+package recommend
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"github.com/mummumgoodboy/gateway/package/agg"
+	"github.com/mummumgoodboy/gateway/proto"
+)
+
+// diversityOverfetch is how many times a page's worth of popular foods a
+// diversified fallback page is filled from.
+const diversityOverfetch = 3
+
+// diversity re-ranks a page so that it is not dominated by one restaurant.
+// The zero value keeps the recommender's order.
+//
+// Foods over the cap are pushed back rather than dropped. Diversified results
+// are only paged by cursor: the ranking is arranged into pages once, when it
+// is frozen, so every food is on exactly one page. Offset pages re-ranked on
+// their own would repeat the foods one page pushed back and skip others.
+type diversity struct {
+	maxPerRestaurant int
+	interleave       bool
+}
+
+func parseDiversity(c *fiber.Ctx) (diversity, []api.FieldError) {
+	var (
+		d    diversity
+		errs []api.FieldError
+	)
+
+	if c.Query("max_per_restaurant") != "" {
+		d.maxPerRestaurant = c.QueryInt("max_per_restaurant", 0)
+		if d.maxPerRestaurant < 1 {
+			errs = append(errs, api.FieldError{Field: "max_per_restaurant", Message: "must be a positive integer"})
+		}
+	}
+
+	switch c.Query("interleave") {
+	case "", "false":
+	case "true":
+		d.interleave = true
+	default:
+		errs = append(errs, api.FieldError{Field: "interleave", Message: "must be true or false"})
+	}
+
+	return d, errs
+}
+
+// apply re-ranks foods and keeps the first limit of them.
+func (d diversity) apply(foods []*proto.Food, limit int) []*proto.Food {
+	if d != (diversity{}) {
+		foods = agg.Diversify(foods, restaurantOf, d.maxPerRestaurant, d.interleave)
+	}
+
+	return foods[:min(limit, len(foods))]
+}
+
+// arrange re-ranks foods into pages of pageSize, see agg.DiversifyPages.
+func (d diversity) arrange(foods []*proto.Food, pageSize int) []*proto.Food {
+	if d == (diversity{}) {
+		return foods
+	}
+
+	return agg.DiversifyPages(foods, restaurantOf, pageSize, d.maxPerRestaurant, d.interleave)
+}
+
+func restaurantOf(v *proto.Food) string {
+	return v.RestaurantId
+}
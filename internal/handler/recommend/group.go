@@ -0,0 +1,218 @@
+package recommend
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"github.com/mummumgoodboy/gateway/package/agg"
+	"github.com/mummumgoodboy/gateway/package/cursor"
+	"github.com/mummumgoodboy/gateway/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	maxGroupSize  = 10
+	maxGroupLimit = 100
+	// groupDepth is how many recommendations are fetched per member before
+	// aggregating.
+	groupDepth = 100
+)
+
+const (
+	methodBorda       = "borda"
+	methodLeastMisery = "least_misery"
+)
+
+// shareKind tells share tokens apart from other payloads signed with the
+// same key.
+const shareKind = "share"
+
+type shareToken struct {
+	Kind   string `json:"k"`
+	UserID uint   `json:"u"`
+}
+
+type ShareResp struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type groupReq struct {
+	UserIds            []uint   `json:"user_ids"`
+	ShareTokens        []string `json:"share_tokens"`
+	Method             string   `json:"method"`
+	Limit              int      `json:"limit"`
+	IncludeRestaurants bool     `json:"include_restaurants"`
+}
+
+type GroupResp struct {
+	Foods       []*proto.Food       `json:"foods"`
+	Restaurants []*proto.Restaurant `json:"restaurants,omitempty"`
+}
+
+// ShareRecommendations issues a token that lets other users include the
+// caller's tastes in a group recommendation.
+func (h *RecommendHandler) ShareRecommendations(c *fiber.Ctx) error {
+	claim := api.MustGetClaims(c)
+
+	expires := time.Now().Add(h.cfg.RecommendConfig.ShareTTL)
+	token, err := h.cursors.Sign(shareToken{Kind: shareKind, UserID: claim.UserId}, expires)
+	if err != nil {
+		return api.ReturnError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(ShareResp{
+		Token:     token,
+		ExpiresAt: expires.UTC().Truncate(time.Second),
+	})
+}
+
+// GetGroupRecommend ranks foods for a group made of the caller and the users
+// named by user IDs, which only admins may pass for others, or by share
+// tokens.
+func (h *RecommendHandler) GetGroupRecommend(c *fiber.Ctx) error {
+	claim := api.MustGetClaims(c)
+
+	var req groupReq
+	if err := c.BodyParser(&req); err != nil {
+		api.Logger(c).Warn("Failed to parse body", "error", err)
+		return api.BadRequest(c)
+	}
+	if req.Method == "" {
+		req.Method = methodBorda
+	}
+	if req.Limit == 0 {
+		req.Limit = 20
+	}
+
+	members := []uint{claim.UserId}
+	var errs []api.FieldError
+	for _, id := range req.UserIds {
+		if id != claim.UserId && !claim.IsAdmin {
+			api.Logger(c).Warn("User may not act for another user",
+				"user", claim.UserId,
+				"target", id,
+			)
+			return api.Forbidden(c)
+		}
+		members = append(members, id)
+	}
+	for i, token := range req.ShareTokens {
+		var share shareToken
+		err := h.cursors.Verify(token, &share)
+		switch {
+		case errors.Is(err, cursor.ErrExpired):
+			errs = append(errs, api.FieldError{Field: fmt.Sprintf("share_tokens[%d]", i), Message: "has expired"})
+		case err != nil || share.Kind != shareKind:
+			errs = append(errs, api.FieldError{Field: fmt.Sprintf("share_tokens[%d]", i), Message: "is invalid"})
+		default:
+			members = append(members, share.UserID)
+		}
+	}
+	slices.Sort(members)
+	members = slices.Compact(members)
+
+	if len(members) < 2 || len(members) > maxGroupSize {
+		errs = append(errs, api.FieldError{
+			Field:   "user_ids",
+			Message: fmt.Sprintf("must make a group of 2 to %d users with share_tokens and the caller", maxGroupSize),
+		})
+	}
+	if req.Method != methodBorda && req.Method != methodLeastMisery {
+		errs = append(errs, api.FieldError{Field: "method", Message: "must be borda or least_misery"})
+	}
+	if req.Limit < 1 || req.Limit > maxGroupLimit {
+		errs = append(errs, api.FieldError{
+			Field:   "limit",
+			Message: fmt.Sprintf("must be between 1 and %d", maxGroupLimit),
+		})
+	}
+	if len(errs) > 0 {
+		return api.ValidationError(c, errs)
+	}
+
+	lists := make([][]string, len(members))
+	listErrs := make([]error, len(members))
+	var wg sync.WaitGroup
+	for i, userID := range members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := h.recommendService.GetFoodRecommendations(c.UserContext(),
+				&proto.GetRecommendationsRequest{
+					UserId: int64(userID),
+					Limit:  groupDepth,
+				})
+			lists[i], listErrs[i] = res.GetItemIds(), err
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(listErrs...); err != nil {
+		api.Logger(c).Warn("Error while getting recommendation",
+			"err", err,
+		)
+		return api.ReturnError(c, err)
+	}
+
+	var ids []string
+	if req.Method == methodLeastMisery {
+		ids = agg.LeastMisery(lists)
+	} else {
+		ids = agg.Borda(lists)
+	}
+	ids = ids[:min(req.Limit, len(ids))]
+
+	resp := GroupResp{Foods: []*proto.Food{}}
+	if len(ids) == 0 {
+		return c.JSON(resp)
+	}
+
+	res, err := h.foodService.GetFoodsByFoodIds(c.UserContext(), &proto.FoodIdsRequest{
+		Ids: ids,
+	})
+	if err != nil {
+		api.Logger(c).Warn("Error while getting food by ids",
+			"err", err,
+		)
+		return api.ReturnError(c, err)
+	}
+	resp.Foods = agg.SortBySlice(ids, res.Foods, func(v *proto.Food) string {
+		return v.Id
+	})
+
+	if req.IncludeRestaurants {
+		resp.Restaurants, err = h.rankRestaurants(c, resp.Foods)
+		if err != nil {
+			return api.ReturnError(c, err)
+		}
+	}
+
+	return c.JSON(resp)
+}
+
+// rankRestaurants orders the restaurants of foods, which are sorted best
+// first, by their best food.
+func (h *RecommendHandler) rankRestaurants(c *fiber.Ctx, foods []*proto.Food) ([]*proto.Restaurant, error) {
+	ids := make([]string, 0, len(foods))
+	for _, f := range foods {
+		ids = append(ids, f.RestaurantId)
+	}
+	ids = agg.Unique(ids)
+
+	res, err := h.foodService.GetRestaurants(c.UserContext(), &emptypb.Empty{})
+	if err != nil {
+		api.Logger(c).Warn("Error while getting restaurants",
+			"err", err,
+		)
+		return nil, err
+	}
+
+	return agg.SortBySlice(ids, res.Restaurants, func(v *proto.Restaurant) string {
+		return v.Id
+	}), nil
+}
@@ -1,14 +1,28 @@
 package recommend
 
 import (
-	"log/slog"
+	"fmt"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/mummumgoodboy/gateway/internal/api"
 	"github.com/mummumgoodboy/gateway/internal/config"
+	"github.com/mummumgoodboy/gateway/internal/popular"
 	"github.com/mummumgoodboy/gateway/package/agg"
+	"github.com/mummumgoodboy/gateway/package/cursor"
 	"github.com/mummumgoodboy/gateway/proto"
-	"github.com/mummumgoodboy/verify"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// HeaderFallback marks recommendations served from the popularity ranking
+// because the recommender is unavailable.
+const HeaderFallback = "X-Recommendation-Fallback"
+
+const maxRecommendLimit = 100
+
+const (
+	paginateOffset = "offset"
+	paginateCursor = "cursor"
 )
 
 type RecommendHandler struct {
@@ -16,66 +30,191 @@ type RecommendHandler struct {
 
 	foodService      proto.RestaurantFoodClient
 	recommendService proto.RecommendServiceClient
-	verify           *verify.JWTVerifier
+	reviewService    proto.ReviewClient
+	swipes           *swipeStore
+	popular          *popular.Store
+	snapshots        *snapshotStore
+	cursors          *cursor.Signer
 }
 
-func NewRecommendHandler(cfg *config.Config, foodService proto.RestaurantFoodClient, recommendService proto.RecommendServiceClient, verify *verify.JWTVerifier) *RecommendHandler {
+func NewRecommendHandler(cfg *config.Config, foodService proto.RestaurantFoodClient, recommendService proto.RecommendServiceClient, reviewService proto.ReviewClient, popularity *popular.Store, cursors *cursor.Signer) *RecommendHandler {
 	return &RecommendHandler{
 		cfg:              cfg,
 		foodService:      foodService,
 		recommendService: recommendService,
-		verify:           verify,
+		reviewService:    reviewService,
+		swipes:           newSwipeStore(cfg.SwipeConfig.SessionTTL),
+		popular:          popularity,
+		snapshots:        newSnapshotStore(cfg.RecommendConfig.CursorTTL),
+		cursors:          cursors,
 	}
 }
 
+// GetRecommend returns the foods recommended to the user, paged by offset
+// through the recommender's live ranking. With paginate=cursor, the first
+// page instead freezes a ranking that the cursor in HeaderNextCursor pages
+// through.
+// Pages can be re-ranked to spread out restaurants, see diversity, which
+// implies paginate=cursor.
+// While the recommender is unavailable, popular foods are served instead and
+// marked with HeaderFallback.
 func (h *RecommendHandler) GetRecommend(c *fiber.Ctx) error {
-	token := api.GetAuthToken(c)
+	var userID uint
+	if claim, ok := api.GetClaims(c); ok {
+		userID = claim.UserId
+	}
+
+	limit := c.QueryInt("limit", 20)
+	offset := c.QueryInt("offset", 0)
+	withNoDelay := c.QueryBool("no_delay", false)
+	token := c.Query("cursor")
+	// Freezing a ranking costs a snapshot of SnapshotSize foods, so only
+	// clients that page by cursor get one.
+	freeze := false
 
-	userID := 0
+	div, errs := parseDiversity(c)
+	if limit < 1 || limit > maxRecommendLimit {
+		errs = append(errs, api.FieldError{
+			Field:   "limit",
+			Message: fmt.Sprintf("must be between 1 and %d", maxRecommendLimit),
+		})
+	}
+	if offset < 0 {
+		errs = append(errs, api.FieldError{Field: "offset", Message: "must not be negative"})
+	}
+	switch c.Query("paginate") {
+	case "", paginateOffset:
+	case paginateCursor:
+		freeze = token == ""
+	default:
+		errs = append(errs, api.FieldError{Field: "paginate", Message: "must be offset or cursor"})
+	}
+	// Diversified pages only fit together when they are arranged at once,
+	// so they are paged through a frozen ranking.
+	if div != (diversity{}) && token == "" {
+		if c.Query("paginate") == paginateOffset {
+			errs = append(errs, api.FieldError{Field: "paginate", Message: "must be cursor with max_per_restaurant or interleave"})
+		}
+		freeze = true
+	}
+	if (token != "" || freeze) && c.Query("offset") != "" {
+		errs = append(errs, api.FieldError{Field: "offset", Message: "cannot be combined with cursor"})
+	}
+	if len(errs) > 0 {
+		return api.ValidationError(c, errs)
+	}
 
 	if token != "" {
-		claim, err := h.verify.Verify(token)
+		cur, snap, errs := h.resolveCursor(token, userID)
+		if errs != nil {
+			return api.ValidationError(c, errs)
+		}
+		ids, err := h.page(c, cur.Snapshot, snap, cur.Offset, limit)
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
+			return api.ReturnError(c, err)
 		}
-
-		userID = int(claim.UserId)
+		return h.sendFoods(c, ids, diversity{}, limit)
 	}
 
-	limit := c.QueryInt("limit", 20)
-	offset := c.QueryInt("offset", 0)
-	withNoDelay := c.QueryBool("no_delay", false)
+	want := limit
+	if div != (diversity{}) {
+		want = limit * diversityOverfetch
+	}
+	fetch := want
+	if freeze {
+		fetch = max(limit, h.cfg.RecommendConfig.SnapshotSize)
+	}
 
 	// Get recommend food
-	recommendFood, err := h.recommendService.GetFoodRecommendations(c.Context(),
+	recommendFood, err := h.recommendService.GetFoodRecommendations(c.UserContext(),
 		&proto.GetRecommendationsRequest{
 			UserId:  int64(userID),
-			Limit:   int32(limit),
+			Limit:   int32(fetch),
 			Offset:  int32(offset),
 			NoDelay: withNoDelay,
 		})
 	if err != nil {
-		slog.Warn("Error while getting recommendation",
+		api.Logger(c).Warn("Error while getting recommendation",
 			"err", err,
 		)
-		return api.InternalError(c)
+		if !h.canFallBack(c, err) {
+			return api.ReturnError(c, err)
+		}
+		ids := h.popular.Top(want, offset)
+		if len(ids) == 0 {
+			return api.ReturnError(c, err)
+		}
+		c.Set(HeaderFallback, "true")
+		return h.sendFoods(c, ids, div, limit)
+	}
+	h.popular.RecordRecommendations(recommendFood.ItemIds)
+
+	ids := recommendFood.ItemIds
+	if !freeze {
+		return h.sendFoods(c, ids, diversity{}, limit)
+	}
+
+	if div != (diversity{}) {
+		foods, err := h.foods(c, ids)
+		if err != nil {
+			return api.ReturnError(c, err)
+		}
+		ids = make([]string, 0, len(foods))
+		for _, f := range div.arrange(foods, limit) {
+			ids = append(ids, f.Id)
+		}
+	}
+	id, snap := h.snapshots.put(userID, ids)
+	if ids, err = h.page(c, id, snap, 0, limit); err != nil {
+		return api.ReturnError(c, err)
+	}
+
+	return h.sendFoods(c, ids, diversity{}, limit)
+}
+
+// sendFoods responds with the first limit foods of ids, in the same order
+// unless div re-ranks them.
+func (h *RecommendHandler) sendFoods(c *fiber.Ctx, ids []string, div diversity, limit int) error {
+	foods, err := h.foods(c, ids)
+	if err != nil {
+		return api.ReturnError(c, err)
+	}
+
+	return c.JSON(div.apply(foods, limit))
+}
+
+// foods looks up the foods of ids, in the same order.
+func (h *RecommendHandler) foods(c *fiber.Ctx, ids []string) ([]*proto.Food, error) {
+	if len(ids) == 0 {
+		return []*proto.Food{}, nil
 	}
 
-	res, err := h.foodService.GetFoodsByFoodIds(c.Context(), &proto.FoodIdsRequest{
-		Ids: recommendFood.ItemIds,
+	res, err := h.foodService.GetFoodsByFoodIds(c.UserContext(), &proto.FoodIdsRequest{
+		Ids: ids,
 	})
 	if err != nil {
-		slog.Warn("Error while getting food by ids",
+		api.Logger(c).Warn("Error while getting food by ids",
 			"err", err,
 		)
-		return api.InternalError(c)
+		return nil, err
 	}
 
-	foods := agg.SortBySlice(recommendFood.ItemIds, res.Foods, func(v *proto.Food) string {
+	return agg.SortBySlice(ids, res.Foods, func(v *proto.Food) string {
 		return v.Id
-	})
+	}), nil
+}
 
-	return c.JSON(foods)
+// canFallBack reports whether err means the recommender is unhealthy, as
+// opposed to the request being wrong or out of time.
+func (h *RecommendHandler) canFallBack(c *fiber.Ctx, err error) bool {
+	if c.UserContext().Err() != nil {
+		return false
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown, codes.ResourceExhausted:
+		return true
+	default:
+		return false
+	}
 }
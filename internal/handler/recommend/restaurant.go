@@ -0,0 +1,119 @@
+package recommend
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"github.com/mummumgoodboy/gateway/package/agg"
+	"github.com/mummumgoodboy/gateway/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const maxRestaurantLimit = 50
+
+// RestaurantRecommendation is a restaurant with its recommended foods, best
+// first.
+type RestaurantRecommendation struct {
+	*proto.Restaurant
+	Foods []*proto.Food `json:"foods"`
+}
+
+// GetRestaurantRecommend ranks restaurants by the recommendations of their
+// foods, see agg.RankGroups. Like GetRecommend it falls back to popular foods
+// while the recommender is unavailable.
+func (h *RecommendHandler) GetRestaurantRecommend(c *fiber.Ctx) error {
+	var userID uint
+	if claim, ok := api.GetClaims(c); ok {
+		userID = claim.UserId
+	}
+
+	limit := c.QueryInt("limit", 10)
+	offset := c.QueryInt("offset", 0)
+
+	var errs []api.FieldError
+	if limit < 1 || limit > maxRestaurantLimit {
+		errs = append(errs, api.FieldError{
+			Field:   "limit",
+			Message: fmt.Sprintf("must be between 1 and %d", maxRestaurantLimit),
+		})
+	}
+	if offset < 0 {
+		errs = append(errs, api.FieldError{Field: "offset", Message: "must not be negative"})
+	}
+	if len(errs) > 0 {
+		return api.ValidationError(c, errs)
+	}
+
+	depth := h.cfg.RecommendConfig.RestaurantDepth
+	recommendFood, err := h.recommendService.GetFoodRecommendations(c.UserContext(),
+		&proto.GetRecommendationsRequest{
+			UserId: int64(userID),
+			Limit:  int32(depth),
+		})
+	if err != nil {
+		api.Logger(c).Warn("Error while getting recommendation",
+			"err", err,
+		)
+		if !h.canFallBack(c, err) {
+			return api.ReturnError(c, err)
+		}
+		ids := h.popular.Top(depth, 0)
+		if len(ids) == 0 {
+			return api.ReturnError(c, err)
+		}
+		recommendFood = &proto.GetRecommendationsResponse{ItemIds: ids}
+		c.Set(HeaderFallback, "true")
+	} else {
+		h.popular.RecordRecommendations(recommendFood.ItemIds)
+	}
+
+	resp := []RestaurantRecommendation{}
+	if len(recommendFood.ItemIds) == 0 {
+		return c.JSON(resp)
+	}
+
+	res, err := h.foodService.GetFoodsByFoodIds(c.UserContext(), &proto.FoodIdsRequest{
+		Ids: recommendFood.ItemIds,
+	})
+	if err != nil {
+		api.Logger(c).Warn("Error while getting food by ids",
+			"err", err,
+		)
+		return api.ReturnError(c, err)
+	}
+	foods := agg.SortBySlice(recommendFood.ItemIds, res.Foods, func(v *proto.Food) string {
+		return v.Id
+	})
+
+	ranked := agg.RankGroups(foods, func(v *proto.Food) string {
+		return v.RestaurantId
+	})
+	if offset >= len(ranked) {
+		return c.JSON(resp)
+	}
+	ranked = ranked[offset:min(offset+limit, len(ranked))]
+
+	restaurants, err := h.foodService.GetRestaurants(c.UserContext(), &emptypb.Empty{})
+	if err != nil {
+		api.Logger(c).Warn("Error while getting restaurants",
+			"err", err,
+		)
+		return api.ReturnError(c, err)
+	}
+
+	byRestaurant := make(map[string][]*proto.Food)
+	for _, f := range foods {
+		byRestaurant[f.RestaurantId] = append(byRestaurant[f.RestaurantId], f)
+	}
+	for _, r := range agg.SortBySlice(ranked, restaurants.Restaurants, func(v *proto.Restaurant) string {
+		return v.Id
+	}) {
+		resp = append(resp, RestaurantRecommendation{
+			Restaurant: r,
+			Foods:      byRestaurant[r.Id],
+		})
+	}
+
+	return c.JSON(resp)
+}
@@ -0,0 +1,125 @@
+package recommend
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"github.com/mummumgoodboy/gateway/package/cursor"
+)
+
+// maxSnapshots bounds the memory held by snapshots. Once reached, the oldest
+// snapshot is evicted to make room, and its cursors expire early.
+const maxSnapshots = 10000
+
+// snapshot is a ranking frozen at the first page, so that later pages neither
+// repeat nor skip foods when the recommender's model changes.
+type snapshot struct {
+	ids     []string
+	userID  uint
+	expires time.Time
+}
+
+// snapshotStore keeps snapshots in memory. A cursor only works on the
+// replica that issued it, and not across restarts.
+type snapshotStore struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	snapshots map[string]*snapshot
+	// order keeps snapshot IDs oldest first. All snapshots live for ttl, so
+	// it is also the order in which they expire.
+	order []string
+}
+
+func newSnapshotStore(ttl time.Duration) *snapshotStore {
+	return &snapshotStore{
+		ttl:       ttl,
+		snapshots: map[string]*snapshot{},
+	}
+}
+
+func (s *snapshotStore) put(userID uint, ids []string) (string, *snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for len(s.order) > 0 {
+		oldest := s.snapshots[s.order[0]]
+		if len(s.order) < maxSnapshots && !now.After(oldest.expires) {
+			break
+		}
+		delete(s.snapshots, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	var b [16]byte
+	rand.Read(b[:])
+	id := hex.EncodeToString(b[:])
+	snap := &snapshot{ids: ids, userID: userID, expires: now.Add(s.ttl)}
+	s.snapshots[id] = snap
+	s.order = append(s.order, id)
+
+	return id, snap
+}
+
+func (s *snapshotStore) get(id string) (*snapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap, ok := s.snapshots[id]
+	if !ok || time.Now().After(snap.expires) {
+		return nil, false
+	}
+	return snap, true
+}
+
+type recommendCursor struct {
+	Snapshot string `json:"s"`
+	Offset   int    `json:"o"`
+	UserID   uint   `json:"u"`
+}
+
+// page returns the foods of snap from offset on and sets the cursor of the
+// page after them, if any.
+func (h *RecommendHandler) page(c *fiber.Ctx, id string, snap *snapshot, offset, limit int) ([]string, error) {
+	offset = min(offset, len(snap.ids))
+	end := min(offset+limit, len(snap.ids))
+	if end < len(snap.ids) {
+		token, err := h.cursors.Sign(recommendCursor{
+			Snapshot: id,
+			Offset:   end,
+			UserID:   snap.userID,
+		}, snap.expires)
+		if err != nil {
+			return nil, err
+		}
+		c.Set(api.HeaderNextCursor, token)
+	}
+
+	return snap.ids[offset:end], nil
+}
+
+// resolveCursor finds the snapshot a cursor points into. The returned field
+// errors are meant for the client.
+func (h *RecommendHandler) resolveCursor(token string, userID uint) (recommendCursor, *snapshot, []api.FieldError) {
+	var cur recommendCursor
+	err := h.cursors.Verify(token, &cur)
+	if errors.Is(err, cursor.ErrExpired) {
+		return cur, nil, []api.FieldError{{Field: "cursor", Message: "has expired"}}
+	}
+	if err != nil || cur.UserID != userID {
+		return cur, nil, []api.FieldError{{Field: "cursor", Message: "is invalid"}}
+	}
+
+	snap, ok := h.snapshots.get(cur.Snapshot)
+	if !ok {
+		return cur, nil, []api.FieldError{{Field: "cursor", Message: "has expired"}}
+	}
+
+	return cur, snap, nil
+}
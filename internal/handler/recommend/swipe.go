@@ -0,0 +1,318 @@
+package recommend
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"github.com/mummumgoodboy/gateway/proto"
+)
+
+const (
+	defaultSwipeBatch = 10
+	maxSwipeBatch     = 50
+	// maxSeen bounds the memory of a single session. The oldest cards are
+	// forgotten first and may be dealt again.
+	maxSeen = 1000
+	// maxSwipeFetches bounds the pages asked of the recommender for a single
+	// batch when cards already seen take up some of them.
+	maxSwipeFetches = 3
+)
+
+const (
+	swipeLike    = "like"
+	swipeDislike = "dislike"
+)
+
+type swipe struct {
+	FoodId string `json:"food_id"`
+	Action string `json:"action"`
+	// favorited is set when the swipe sent the recommender a FAVORITE event,
+	// the only event an undo retracts.
+	favorited bool
+}
+
+type swipeSession struct {
+	lastUsed time.Time
+	seen     map[string]bool
+	// order keeps seen cards oldest first.
+	order   []string
+	history []swipe
+	// offset is how far into the recommendations the deck has been dealt.
+	offset int
+}
+
+func (s *swipeSession) markSeen(ids ...string) {
+	for _, id := range ids {
+		if s.seen[id] {
+			continue
+		}
+		s.seen[id] = true
+		s.order = append(s.order, id)
+	}
+	for len(s.order) > maxSeen {
+		delete(s.seen, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// unsee puts id back in the deck.
+func (s *swipeSession) unsee(id string) {
+	delete(s.seen, id)
+	for i, v := range s.order {
+		if v == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// swipeStore keeps a session per user in memory. Sessions are lost when the
+// gateway restarts, and with several replicas each one keeps its own.
+type swipeStore struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	sessions  map[uint]*swipeSession
+	lastSweep time.Time
+}
+
+func newSwipeStore(ttl time.Duration) *swipeStore {
+	return &swipeStore{
+		ttl:       ttl,
+		sessions:  map[uint]*swipeSession{},
+		lastSweep: time.Now(),
+	}
+}
+
+// with runs fn on the session of userID, starting a new one if it expired.
+func (s *swipeStore) with(userID uint, fn func(*swipeSession)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= s.ttl {
+		for id, session := range s.sessions {
+			if now.Sub(session.lastUsed) >= s.ttl {
+				delete(s.sessions, id)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	session, ok := s.sessions[userID]
+	if !ok || now.Sub(session.lastUsed) >= s.ttl {
+		session = &swipeSession{seen: map[string]bool{}}
+		s.sessions[userID] = session
+	}
+	session.lastUsed = now
+
+	fn(session)
+}
+
+// GetSwipeCards deals the next batch of cards, picking up the
+// recommendations where the last batch left off. Cards already dealt in the
+// session are skipped, and the batch is short when the recommender runs out.
+func (h *RecommendHandler) GetSwipeCards(c *fiber.Ctx) error {
+	claim := api.MustGetClaims(c)
+
+	limit := c.QueryInt("limit", defaultSwipeBatch)
+	if limit < 1 || limit > maxSwipeBatch {
+		return api.ValidationError(c, []api.FieldError{{
+			Field:   "limit",
+			Message: fmt.Sprintf("must be between 1 and %d", maxSwipeBatch),
+		}})
+	}
+
+	var offset int
+	h.swipes.with(claim.UserId, func(s *swipeSession) {
+		offset = s.offset
+	})
+
+	// Swipes change the ranking, so cards already dealt can come up again
+	// further down; another page is asked for to make up for them.
+	ids := make([]string, 0, limit)
+	for range maxSwipeFetches {
+		want := limit - len(ids)
+		recommendFood, err := h.recommendService.GetFoodRecommendations(c.UserContext(),
+			&proto.GetRecommendationsRequest{
+				UserId:  int64(claim.UserId),
+				Limit:   int32(want),
+				Offset:  int32(offset),
+				NoDelay: true,
+			})
+		if err != nil {
+			api.Logger(c).Warn("Error while getting recommendation",
+				"err", err,
+			)
+			return api.ReturnError(c, err)
+		}
+
+		h.swipes.with(claim.UserId, func(s *swipeSession) {
+			for _, id := range recommendFood.ItemIds {
+				if !s.seen[id] && !slices.Contains(ids, id) {
+					ids = append(ids, id)
+				}
+			}
+		})
+		offset += len(recommendFood.ItemIds)
+		if len(ids) >= limit || len(recommendFood.ItemIds) < want {
+			break
+		}
+	}
+	ids = ids[:min(len(ids), limit)]
+
+	foods, err := h.foods(c, ids)
+	if err != nil {
+		return api.ReturnError(c, err)
+	}
+	// Only cards that reached the client count as dealt.
+	h.swipes.with(claim.UserId, func(s *swipeSession) {
+		s.markSeen(ids...)
+		s.offset = max(s.offset, offset)
+	})
+
+	return c.JSON(foods)
+}
+
+// Swipe records a like or dislike of a card, see recordSwipe.
+func (h *RecommendHandler) Swipe(c *fiber.Ctx) error {
+	claim := api.MustGetClaims(c)
+
+	var req swipe
+	if err := c.BodyParser(&req); err != nil {
+		api.Logger(c).Warn("Failed to parse body", "error", err)
+		return api.BadRequest(c)
+	}
+
+	var errs []api.FieldError
+	if req.FoodId == "" {
+		errs = append(errs, api.FieldError{Field: "food_id", Message: "is required"})
+	}
+	if req.Action != swipeLike && req.Action != swipeDislike {
+		errs = append(errs, api.FieldError{Field: "action", Message: "must be like or dislike"})
+	}
+	if len(errs) > 0 {
+		return api.ValidationError(c, errs)
+	}
+
+	favorited, err := h.recordSwipe(c, claim.UserId, req)
+	if err != nil {
+		api.Logger(c).Warn("Failed to record swipe", "error", err)
+		return api.ReturnError(c, err)
+	}
+	req.favorited = favorited
+
+	h.swipes.with(claim.UserId, func(s *swipeSession) {
+		s.markSeen(req.FoodId)
+		s.history = append(s.history, req)
+		if len(s.history) > maxSeen {
+			s.history = s.history[1:]
+		}
+	})
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// UndoSwipe retracts the last swipe of the session and puts its card back in
+// the deck.
+func (h *RecommendHandler) UndoSwipe(c *fiber.Ctx) error {
+	claim := api.MustGetClaims(c)
+
+	var (
+		last swipe
+		ok   bool
+	)
+	h.swipes.with(claim.UserId, func(s *swipeSession) {
+		if len(s.history) == 0 {
+			return
+		}
+		last, ok = s.history[len(s.history)-1], true
+		s.history = s.history[:len(s.history)-1]
+	})
+	if !ok {
+		return api.NotFound(c)
+	}
+
+	if err := h.retractSwipe(c, claim.UserId, last); err != nil {
+		// Keep the swipe so that the client can try again.
+		h.swipes.with(claim.UserId, func(s *swipeSession) {
+			s.history = append(s.history, last)
+		})
+		api.Logger(c).Warn("Failed to undo swipe", "error", err)
+		return api.ReturnError(c, err)
+	}
+
+	h.swipes.with(claim.UserId, func(s *swipeSession) {
+		s.unsee(last.FoodId)
+	})
+
+	return c.JSON(last)
+}
+
+// recordSwipe tells the recommender about s and reports whether it sent a
+// FAVORITE event. The recommender has no negative event, so a dislike only
+// takes the card out of the deck. A like counts as a favorite unless the
+// food already is one, in which case there is nothing to add or to undo.
+func (h *RecommendHandler) recordSwipe(c *fiber.Ctx, userID uint, s swipe) (bool, error) {
+	if s.Action != swipeLike {
+		return false, nil
+	}
+
+	liked := false
+	h.swipes.with(userID, func(session *swipeSession) {
+		liked = slices.ContainsFunc(session.history, func(prev swipe) bool {
+			return prev.favorited && prev.FoodId == s.FoodId
+		})
+	})
+	if liked {
+		return false, nil
+	}
+	favorite, err := h.isFavorite(c, userID, s.FoodId)
+	if err != nil || favorite {
+		return false, err
+	}
+
+	_, err = h.recommendService.AddEvent(c.UserContext(), &proto.AddEventReq{
+		EventType: proto.EventType_FAVORITE,
+		UserId:    int64(userID),
+		ItemId:    s.FoodId,
+	})
+	return err == nil, err
+}
+
+// retractSwipe removes the FAVORITE event that s sent, unless the user has
+// since made the food a favorite of their own.
+func (h *RecommendHandler) retractSwipe(c *fiber.Ctx, userID uint, s swipe) error {
+	if !s.favorited {
+		return nil
+	}
+	favorite, err := h.isFavorite(c, userID, s.FoodId)
+	if err != nil || favorite {
+		return err
+	}
+
+	_, err = h.recommendService.RemoveEvent(c.UserContext(), &proto.RemoveEventReq{
+		EventType: proto.EventType_FAVORITE,
+		UserId:    int64(userID),
+		ItemId:    s.FoodId,
+	})
+	return err
+}
+
+func (h *RecommendHandler) isFavorite(c *fiber.Ctx, userID uint, foodID string) (bool, error) {
+	favorites, err := h.reviewService.GetFavoriteFoodsByUserId(c.UserContext(), &proto.GetFavoriteFoodsByUserIDRequest{
+		UserId: int32(userID),
+	})
+	if err != nil {
+		api.Logger(c).Warn("Failed to retrieve favorite foods", "error", err)
+		return false, err
+	}
+
+	return slices.ContainsFunc(favorites.FavoriteFoods, func(f *proto.FavoriteFoodResponse) bool {
+		return f.FoodId == foodID
+	}), nil
+}
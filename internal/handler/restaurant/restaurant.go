@@ -0,0 +1,98 @@
+package restaurant
+
+import (
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"github.com/mummumgoodboy/gateway/internal/config"
+	"github.com/mummumgoodboy/gateway/internal/rating"
+	"github.com/mummumgoodboy/gateway/proto"
+)
+
+// DetailResp is everything the restaurant page shows. Sections listed in
+// Warnings are null.
+type DetailResp struct {
+	Restaurant *proto.Restaurant       `json:"restaurant"`
+	Foods      []*proto.Food           `json:"foods"`
+	Reviews    []*proto.ReviewResponse `json:"reviews"`
+	Rating     *rating.Summary         `json:"rating"`
+	Warnings   []api.Warning           `json:"warnings,omitempty"`
+}
+
+type RestaurantHandler struct {
+	cfg *config.Config
+
+	foodService proto.RestaurantFoodClient
+	ratings     *rating.Service
+}
+
+func NewRestaurantHandler(cfg *config.Config, foodService proto.RestaurantFoodClient, ratings *rating.Service) *RestaurantHandler {
+	return &RestaurantHandler{cfg: cfg, foodService: foodService, ratings: ratings}
+}
+
+// GetDetail fetches a restaurant, its menu and its reviews concurrently. Only
+// the restaurant itself is required; the other sections are left out with a
+// warning when their upstream fails. The rating is summarised from the
+// reviews, which also refreshes the cached summary.
+func (h *RestaurantHandler) GetDetail(c *fiber.Ctx) error {
+	id := c.Params("restaurantId")
+
+	var (
+		wg         sync.WaitGroup
+		resp       DetailResp
+		restErr    error
+		foodsErr   error
+		reviewsErr error
+	)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		resp.Restaurant, restErr = h.foodService.GetRestaurantByRestaurantId(c.UserContext(), &proto.RestaurantIdRequest{
+			Id: id,
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		var res *proto.GetFoodResponse
+		res, foodsErr = h.foodService.GetFoodsByRestaurantId(c.UserContext(), &proto.RestaurantIdRequest{
+			Id: id,
+		})
+		resp.Foods = res.GetFoods()
+	}()
+	go func() {
+		defer wg.Done()
+		var summary rating.Summary
+		summary, resp.Reviews, reviewsErr = h.ratings.RestaurantReviews(c.UserContext(), id)
+		resp.Rating = &summary
+	}()
+	wg.Wait()
+
+	if restErr != nil {
+		api.Logger(c).Warn("Failed to get restaurant", "error", restErr)
+		return api.ReturnError(c, restErr)
+	}
+
+	if foodsErr != nil {
+		api.Logger(c).Warn("Failed to get foods", "error", foodsErr)
+		resp.Foods = nil
+		resp.Warnings = append(resp.Warnings, api.NewWarning("foods", foodsErr))
+	} else if resp.Foods == nil {
+		resp.Foods = []*proto.Food{}
+	}
+
+	if reviewsErr != nil {
+		api.Logger(c).Warn("Failed to retrieve reviews", "error", reviewsErr)
+		resp.Reviews = nil
+		resp.Rating = nil
+		// The rating is summarised from the reviews, so it is lost too.
+		resp.Warnings = append(resp.Warnings,
+			api.NewWarning("reviews", reviewsErr),
+			api.NewWarning("rating", reviewsErr),
+		)
+	} else if resp.Reviews == nil {
+		resp.Reviews = []*proto.ReviewResponse{}
+	}
+
+	return c.JSON(resp)
+}
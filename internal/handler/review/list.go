@@ -0,0 +1,265 @@
+package review
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"github.com/mummumgoodboy/gateway/internal/profile"
+	"github.com/mummumgoodboy/gateway/package/agg"
+	"github.com/mummumgoodboy/gateway/package/cursor"
+	"github.com/mummumgoodboy/gateway/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+const (
+	sortNewest  = "newest"
+	sortOldest  = "oldest"
+	sortHighest = "highest"
+	sortLowest  = "lowest"
+)
+
+// ReviewResp is a review with the public profile of its author, which is
+// left out when the auth service cannot tell it.
+type ReviewResp struct {
+	*proto.ReviewResponse
+	Reviewer *profile.Profile `json:"reviewer,omitempty"`
+}
+
+// listQuery pages through the reviews of a food or restaurant. The review
+// service returns them all at once, so the gateway sorts, filters and pages
+// them until it can do so itself.
+type listQuery struct {
+	// resource names what the reviews are of, such as "food/<id>".
+	resource   string
+	sort       string
+	minRating  float64
+	hasContent *bool
+	userID     *int32
+	limit      int
+	after      *reviewCursor
+}
+
+// reviewCursor holds the sort key of the last review of a page. Unlike an
+// offset it stays put when reviews are added or removed between pages. It
+// only pages through the listing it came from, with the same filters.
+type reviewCursor struct {
+	Resource  string  `json:"res"`
+	Filters   string  `json:"f"`
+	Sort      string  `json:"s"`
+	Rating    float32 `json:"r"`
+	CreatedAt int64   `json:"t"`
+	ReviewID  string  `json:"id"`
+}
+
+func (cur reviewCursor) review() *proto.ReviewResponse {
+	return &proto.ReviewResponse{
+		ReviewId:  cur.ReviewID,
+		Rating:    cur.Rating,
+		CreatedAt: timestamppb.New(time.Unix(0, cur.CreatedAt)),
+	}
+}
+
+// parseListQuery parses the parameters of a listing of the reviews of
+// resource, see listQuery.
+func (h *ReviewHandler) parseListQuery(c *fiber.Ctx, resource string) (listQuery, []api.FieldError) {
+	q := listQuery{
+		resource: resource,
+		sort:     c.Query("sort", sortNewest),
+		limit:    c.QueryInt("limit", defaultListLimit),
+	}
+	var errs []api.FieldError
+
+	switch q.sort {
+	case sortNewest, sortOldest, sortHighest, sortLowest:
+	default:
+		errs = append(errs, api.FieldError{Field: "sort", Message: "must be newest, oldest, highest or lowest"})
+	}
+
+	if q.limit < 1 || q.limit > maxListLimit {
+		errs = append(errs, api.FieldError{
+			Field:   "limit",
+			Message: fmt.Sprintf("must be between 1 and %d", maxListLimit),
+		})
+	}
+
+	if raw := c.Query("min_rating"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(v) || v < 0 || v > 5 {
+			errs = append(errs, api.FieldError{Field: "min_rating", Message: "must be a number between 0 and 5"})
+		}
+		q.minRating = v
+	}
+
+	if raw := c.Query("has_content"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			errs = append(errs, api.FieldError{Field: "has_content", Message: "must be true or false"})
+		}
+		q.hasContent = &v
+	}
+
+	if raw := c.Query("user_id"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || v < 1 {
+			errs = append(errs, api.FieldError{Field: "user_id", Message: "must be a positive integer"})
+		}
+		id := int32(v)
+		q.userID = &id
+	}
+
+	if token := c.Query("cursor"); token != "" {
+		var cur reviewCursor
+		err := h.cursors.Verify(token, &cur)
+		switch {
+		case errors.Is(err, cursor.ErrExpired):
+			errs = append(errs, api.FieldError{Field: "cursor", Message: "has expired"})
+		case err != nil || cur.Resource != q.resource || cur.Filters != q.filters() || cur.Sort != q.sort:
+			errs = append(errs, api.FieldError{Field: "cursor", Message: "is invalid"})
+		default:
+			q.after = &cur
+		}
+	}
+
+	return q, errs
+}
+
+// filters hashes the filters of q, so that a cursor can tell whether they
+// changed without carrying them.
+func (q listQuery) filters() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "min_rating=%g", q.minRating)
+	if q.hasContent != nil {
+		fmt.Fprintf(&b, "&has_content=%t", *q.hasContent)
+	}
+	if q.userID != nil {
+		fmt.Fprintf(&b, "&user_id=%d", *q.userID)
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+func (q listQuery) match(r *proto.ReviewResponse) bool {
+	if float64(r.Rating) < q.minRating {
+		return false
+	}
+	if q.hasContent != nil && (strings.TrimSpace(r.Content) != "") != *q.hasContent {
+		return false
+	}
+	if q.userID != nil && r.UserId != *q.userID {
+		return false
+	}
+	return true
+}
+
+// compare orders reviews by the sort of q. Ties fall back to the newest
+// review, then to the review ID, so that every review has a single place.
+func (q listQuery) compare(a, b *proto.ReviewResponse) int {
+	byTime := b.GetCreatedAt().AsTime().Compare(a.GetCreatedAt().AsTime())
+	var c int
+	switch q.sort {
+	case sortOldest:
+		c = -byTime
+	case sortHighest:
+		c = cmp.Compare(b.Rating, a.Rating)
+	case sortLowest:
+		c = cmp.Compare(a.Rating, b.Rating)
+	}
+	if c != 0 {
+		return c
+	}
+	if q.sort != sortOldest && byTime != 0 {
+		return byTime
+	}
+	return cmp.Compare(a.ReviewId, b.ReviewId)
+}
+
+// pageReviews returns the page of reviews q asks for. The number of reviews
+// matching the filters goes in HeaderTotalCount and the cursor of the next
+// page, if any, in HeaderNextCursor.
+func (h *ReviewHandler) pageReviews(c *fiber.Ctx, reviews []*proto.ReviewResponse, q listQuery) ([]*proto.ReviewResponse, error) {
+	matched := make([]*proto.ReviewResponse, 0, len(reviews))
+	for _, r := range reviews {
+		if q.match(r) {
+			matched = append(matched, r)
+		}
+	}
+	slices.SortFunc(matched, q.compare)
+	c.Set(api.HeaderTotalCount, strconv.Itoa(len(matched)))
+
+	start := 0
+	if q.after != nil {
+		last := q.after.review()
+		start, _ = slices.BinarySearchFunc(matched, last, q.compare)
+		if start < len(matched) && q.compare(matched[start], last) == 0 {
+			start++
+		}
+	}
+	end := min(start+q.limit, len(matched))
+	page := matched[start:end]
+
+	if end < len(matched) {
+		last := page[len(page)-1]
+		token, err := h.cursors.Sign(reviewCursor{
+			Resource:  q.resource,
+			Filters:   q.filters(),
+			Sort:      q.sort,
+			Rating:    last.Rating,
+			CreatedAt: last.GetCreatedAt().AsTime().UnixNano(),
+			ReviewID:  last.ReviewId,
+		}, time.Now().Add(h.cfg.ReviewConfig.CursorTTL))
+		if err != nil {
+			return nil, err
+		}
+		c.Set(api.HeaderNextCursor, token)
+	}
+
+	return page, nil
+}
+
+// sendReviews sends the page of reviews q asks for with their reviewers.
+func (h *ReviewHandler) sendReviews(c *fiber.Ctx, reviews []*proto.ReviewResponse, q listQuery) error {
+	page, err := h.pageReviews(c, reviews, q)
+	if err != nil {
+		return api.ReturnError(c, err)
+	}
+
+	return c.JSON(h.withReviewers(c, page))
+}
+
+// withReviewers adds the profiles of their authors to reviews. Reviews are
+// still sent without them when the auth service fails.
+func (h *ReviewHandler) withReviewers(c *fiber.Ctx, reviews []*proto.ReviewResponse) []ReviewResp {
+	ids := make([]uint, 0, len(reviews))
+	for _, r := range reviews {
+		ids = append(ids, uint(r.UserId))
+	}
+	profiles, err := h.profiles.Get(c.UserContext(), agg.Unique(ids))
+	if err != nil {
+		api.Logger(c).Warn("Failed to get reviewer profiles", "error", err)
+	}
+
+	resp := make([]ReviewResp, 0, len(reviews))
+	for _, r := range reviews {
+		review := ReviewResp{ReviewResponse: r}
+		if p, ok := profiles[uint(r.UserId)]; ok {
+			review.Reviewer = &p
+		}
+		resp = append(resp, review)
+	}
+	return resp
+}
@@ -0,0 +1,311 @@
+package review
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"github.com/mummumgoodboy/gateway/package/agg"
+	"github.com/mummumgoodboy/gateway/package/cursor"
+	"github.com/mummumgoodboy/gateway/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// userReviewsConcurrency bounds the calls in flight while gathering the
+// reviews of a user, see userReviews.
+const userReviewsConcurrency = 8
+
+const (
+	activityReview   = "review"
+	activityFavorite = "favorite"
+)
+
+// activityKind tells activity cursors apart from other payloads signed with
+// the same key.
+const activityKind = "activity"
+
+// MyReviewResp is a review of the caller with the names of what it is about.
+// Names are left out when the food service cannot tell them.
+type MyReviewResp struct {
+	*proto.ReviewResponse
+	FoodName       string `json:"food_name,omitempty"`
+	RestaurantName string `json:"restaurant_name,omitempty"`
+}
+
+// Activity is a review or a favorite of the caller. Favorites carry no time
+// since the review service does not record when they were added, so they
+// cannot be placed among reviews and are all listed after them.
+type Activity struct {
+	Type           string                `json:"type"`
+	Time           *time.Time            `json:"time,omitempty"`
+	Review         *proto.ReviewResponse `json:"review,omitempty"`
+	FoodID         string                `json:"food_id,omitempty"`
+	FoodName       string                `json:"food_name,omitempty"`
+	RestaurantID   string                `json:"restaurant_id,omitempty"`
+	RestaurantName string                `json:"restaurant_name,omitempty"`
+}
+
+type activityCursor struct {
+	Kind   string `json:"k"`
+	UserID uint   `json:"u"`
+	Offset int    `json:"o"`
+}
+
+// GetMyReviews lists the caller's reviews, newest first unless sorted
+// otherwise, with the same parameters as the other review listings. The list
+// is marked with api.HeaderPartial when some reviews could not be gathered,
+// see userReviews.
+func (h *ReviewHandler) GetMyReviews(c *fiber.Ctx) error {
+	claim := api.MustGetClaims(c)
+
+	q, errs := h.parseListQuery(c, "user/"+strconv.FormatUint(uint64(claim.UserId), 10))
+	if len(errs) > 0 {
+		return api.ValidationError(c, errs)
+	}
+
+	mine, err := h.userReviews(c, claim.UserId)
+	if err != nil {
+		return api.ReturnError(c, err)
+	}
+	if mine.partial {
+		c.Set(api.HeaderPartial, "true")
+	}
+
+	page, err := h.pageReviews(c, mine.reviews, q)
+	if err != nil {
+		return api.ReturnError(c, err)
+	}
+
+	ids := make([]string, 0, len(page))
+	for _, r := range page {
+		ids = append(ids, r.FoodId)
+	}
+	foods := h.foodNames(c, ids)
+
+	resp := make([]MyReviewResp, 0, len(page))
+	for _, r := range page {
+		resp = append(resp, MyReviewResp{
+			ReviewResponse: r,
+			FoodName:       foods[r.FoodId],
+			RestaurantName: mine.restaurants[r.RestaurantId],
+		})
+	}
+
+	return c.JSON(resp)
+}
+
+// GetMyActivity lists the caller's reviews, newest first, followed by their
+// favorites, which carry no time; see Activity. Pages are cut by offset, so a
+// page may repeat or skip an item when the caller adds or removes one
+// meanwhile, or when reviews are missing from a page marked with
+// api.HeaderPartial.
+func (h *ReviewHandler) GetMyActivity(c *fiber.Ctx) error {
+	claim := api.MustGetClaims(c)
+
+	limit := c.QueryInt("limit", defaultListLimit)
+	if limit < 1 || limit > maxListLimit {
+		return api.ValidationError(c, []api.FieldError{{
+			Field:   "limit",
+			Message: fmt.Sprintf("must be between 1 and %d", maxListLimit),
+		}})
+	}
+
+	var offset int
+	if token := c.Query("cursor"); token != "" {
+		var cur activityCursor
+		err := h.cursors.Verify(token, &cur)
+		switch {
+		case errors.Is(err, cursor.ErrExpired):
+			return api.ValidationError(c, []api.FieldError{{Field: "cursor", Message: "has expired"}})
+		case err != nil || cur.Kind != activityKind || cur.UserID != claim.UserId:
+			return api.ValidationError(c, []api.FieldError{{Field: "cursor", Message: "is invalid"}})
+		}
+		offset = cur.Offset
+	}
+
+	var (
+		wg           sync.WaitGroup
+		mine         userReviews
+		favorites    *proto.GetFavoriteFoodsByUserIDResponse
+		reviewsErr   error
+		favoritesErr error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		mine, reviewsErr = h.userReviews(c, claim.UserId)
+	}()
+	go func() {
+		defer wg.Done()
+		favorites, favoritesErr = h.reviewService.GetFavoriteFoodsByUserId(c.UserContext(), &proto.GetFavoriteFoodsByUserIDRequest{
+			UserId: int32(claim.UserId),
+		})
+	}()
+	wg.Wait()
+	if reviewsErr != nil {
+		return api.ReturnError(c, reviewsErr)
+	}
+	if favoritesErr != nil {
+		api.Logger(c).Warn("Failed to retrieve favorite foods", "error", favoritesErr)
+		return api.ReturnError(c, favoritesErr)
+	}
+
+	if mine.partial {
+		c.Set(api.HeaderPartial, "true")
+	}
+	slices.SortFunc(mine.reviews, listQuery{sort: sortNewest}.compare)
+
+	activity := make([]Activity, 0, len(mine.reviews)+len(favorites.GetFavoriteFoods()))
+	for _, r := range mine.reviews {
+		t := r.GetCreatedAt().AsTime()
+		activity = append(activity, Activity{
+			Type:         activityReview,
+			Time:         &t,
+			Review:       r,
+			FoodID:       r.FoodId,
+			RestaurantID: r.RestaurantId,
+		})
+	}
+	for _, f := range favorites.GetFavoriteFoods() {
+		activity = append(activity, Activity{
+			Type:         activityFavorite,
+			FoodID:       f.FoodId,
+			RestaurantID: f.RestaurantId,
+		})
+	}
+
+	c.Set(api.HeaderTotalCount, strconv.Itoa(len(activity)))
+	offset = min(offset, len(activity))
+	end := min(offset+limit, len(activity))
+	if end < len(activity) {
+		token, err := h.cursors.Sign(activityCursor{
+			Kind:   activityKind,
+			UserID: claim.UserId,
+			Offset: end,
+		}, time.Now().Add(h.cfg.ReviewConfig.CursorTTL))
+		if err != nil {
+			return api.ReturnError(c, err)
+		}
+		c.Set(api.HeaderNextCursor, token)
+	}
+	activity = activity[offset:end]
+
+	ids := make([]string, 0, len(activity))
+	for _, a := range activity {
+		ids = append(ids, a.FoodID)
+	}
+	foods := h.foodNames(c, ids)
+	for i := range activity {
+		activity[i].FoodName = foods[activity[i].FoodID]
+		activity[i].RestaurantName = mine.restaurants[activity[i].RestaurantID]
+	}
+
+	return c.JSON(activity)
+}
+
+// userReviews is what the review service could tell of a user's reviews.
+type userReviews struct {
+	reviews []*proto.ReviewResponse
+	// restaurants holds the names of all restaurants, keyed by ID.
+	restaurants map[string]string
+	// partial is set when the reviews of some restaurants are missing.
+	partial bool
+}
+
+// userReviews gathers the reviews of userID. The review service can only list
+// reviews by food or restaurant, so this asks for the reviews of every
+// restaurant, userReviewsConcurrency at a time. Restaurants whose reviews
+// cannot be listed are skipped and the result marked partial; only when all
+// of them fail does the call fail.
+func (h *ReviewHandler) userReviews(c *fiber.Ctx, userID uint) (userReviews, error) {
+	res, err := h.foodService.GetRestaurants(c.UserContext(), &emptypb.Empty{})
+	if err != nil {
+		api.Logger(c).Warn("Failed to get restaurants", "error", err)
+		return userReviews{}, err
+	}
+
+	names := make(map[string]string, len(res.Restaurants))
+	for _, r := range res.Restaurants {
+		names[r.Id] = r.Name
+	}
+
+	lists := make([][]*proto.ReviewResponse, len(res.Restaurants))
+	errs := make([]error, len(res.Restaurants))
+	sem := make(chan struct{}, userReviewsConcurrency)
+	var wg sync.WaitGroup
+	for i, r := range res.Restaurants {
+		select {
+		case sem <- struct{}{}:
+		case <-c.UserContext().Done():
+			errs[i] = c.UserContext().Err()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			res, err := h.reviewService.GetReviewsByRestaurantId(c.UserContext(), &proto.GetReviewsByRestaurantRequest{
+				RestaurantId: r.Id,
+			})
+			errs[i] = err
+			for _, review := range res.GetReviews() {
+				if review.UserId == int32(userID) {
+					lists[i] = append(lists[i], review)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	result := userReviews{restaurants: names}
+	var failed []error
+	for i, r := range res.Restaurants {
+		if errs[i] != nil {
+			api.Logger(c).Warn("Failed to retrieve reviews of restaurant",
+				"restaurant", r.Id,
+				"error", errs[i],
+			)
+			failed = append(failed, errs[i])
+			continue
+		}
+		result.reviews = append(result.reviews, lists[i]...)
+	}
+	if len(failed) > 0 && len(failed) == len(res.Restaurants) {
+		return userReviews{}, failed[0]
+	}
+	result.partial = len(failed) > 0
+
+	return result, nil
+}
+
+// foodNames looks up the names of foods by ID. Names are left out, rather
+// than failing the request, when the food service fails.
+func (h *ReviewHandler) foodNames(c *fiber.Ctx, ids []string) map[string]string {
+	names := map[string]string{}
+	// Reviews of a restaurant as a whole carry no food.
+	ids = slices.DeleteFunc(agg.Unique(ids), func(id string) bool {
+		return id == ""
+	})
+	if len(ids) == 0 {
+		return names
+	}
+
+	res, err := h.foodService.GetFoodsByFoodIds(c.UserContext(), &proto.FoodIdsRequest{
+		Ids: ids,
+	})
+	if err != nil {
+		api.Logger(c).Warn("Failed to get food by ids", "error", err)
+		return names
+	}
+	for _, f := range res.Foods {
+		names[f.Id] = f.Name
+	}
+	return names
+}
@@ -1,98 +1,176 @@
 package review
 
 import (
-	"log/slog"
-
 	"github.com/gofiber/fiber/v2"
 	"github.com/mummumgoodboy/gateway/internal/api"
 	"github.com/mummumgoodboy/gateway/internal/config"
+	"github.com/mummumgoodboy/gateway/internal/events"
+	"github.com/mummumgoodboy/gateway/internal/popular"
+	"github.com/mummumgoodboy/gateway/internal/profile"
+	"github.com/mummumgoodboy/gateway/internal/rating"
+	"github.com/mummumgoodboy/gateway/package/cursor"
 	"github.com/mummumgoodboy/gateway/proto"
-	"github.com/mummumgoodboy/verify"
 )
 
 type ReviewHandler struct {
 	cfg           *config.Config
 	reviewService proto.ReviewClient
 	foodService   proto.RestaurantFoodClient
-	verify        *verify.JWTVerifier
+	events        *events.Emitter
+	popular       *popular.Store
+	ratings       *rating.Service
+	cursors       *cursor.Signer
+	profiles      *profile.Store
 }
 
-func NewReviewHandler(cfg *config.Config, reviewService proto.ReviewClient, foodService proto.RestaurantFoodClient, verifier *verify.JWTVerifier) *ReviewHandler {
-	return &ReviewHandler{cfg: cfg, reviewService: reviewService, foodService: foodService, verify: verifier}
+func NewReviewHandler(cfg *config.Config, reviewService proto.ReviewClient, foodService proto.RestaurantFoodClient, emitter *events.Emitter, popularity *popular.Store, ratings *rating.Service, cursors *cursor.Signer, profiles *profile.Store) *ReviewHandler {
+	return &ReviewHandler{
+		cfg:           cfg,
+		reviewService: reviewService,
+		foodService:   foodService,
+		events:        emitter,
+		popular:       popularity,
+		ratings:       ratings,
+		cursors:       cursors,
+		profiles:      profiles,
+	}
 }
 
 // CreateReview handles the creation of a review for a restaurant.
 func (h *ReviewHandler) CreateReview(c *fiber.Ctx) error {
-	claim, err := h.verify.Verify(api.GetAuthToken(c))
-	if err != nil {
-		slog.Warn("Failed to verify token", "error", err)
-		return api.Unauthorized(c)
-	}
+	claim := api.MustGetClaims(c)
 
 	review := new(proto.ReviewRequest)
 	if err := c.BodyParser(review); err != nil {
-		slog.Warn("Failed to parse body", "error", err)
+		api.Logger(c).Warn("Failed to parse body", "error", err)
 		return api.BadRequest(c)
 	}
 	review.UserId = int32(claim.UserId)
 
-	createdReview, err := h.reviewService.CreateReview(c.Context(), review)
+	createdReview, err := h.reviewService.CreateReview(c.UserContext(), review)
 	if err != nil {
-		slog.Warn("Failed to create review", "error", err)
+		api.Logger(c).Warn("Failed to create review", "error", err)
 		return api.ReturnError(c, err)
 	}
+	h.emitRating(c, createdReview, false)
+	h.ratings.Invalidate(createdReview.FoodId, createdReview.RestaurantId)
+	if createdReview.FoodId != "" {
+		h.popular.RecordRating(createdReview.ReviewId, createdReview.FoodId, createdReview.Rating)
+	}
+
 	return c.Status(201).JSON(createdReview)
 }
 
-// GetReviewsByRestaurantId retrieves all reviews for a specific restaurant.
+// GetReviewsByRestaurantId retrieves a page of reviews for a specific
+// restaurant, see listQuery.
 func (h *ReviewHandler) GetReviewsByRestaurantId(c *fiber.Ctx) error {
-	_, err := h.foodService.GetRestaurantByRestaurantId(c.Context(), &proto.RestaurantIdRequest{
+	q, errs := h.parseListQuery(c, "restaurant/"+c.Params("restaurantId"))
+	if len(errs) > 0 {
+		return api.ValidationError(c, errs)
+	}
+
+	_, err := h.foodService.GetRestaurantByRestaurantId(c.UserContext(), &proto.RestaurantIdRequest{
 		Id: c.Params("restaurantId"),
 	})
 	if err != nil {
-		slog.Warn("Failed to get restaurant", "error", err)
+		api.Logger(c).Warn("Failed to get restaurant", "error", err)
 		return api.ReturnError(c, err)
 	}
 
-	response, err := h.reviewService.GetReviewsByRestaurantId(c.Context(), &proto.GetReviewsByRestaurantRequest{
+	response, err := h.reviewService.GetReviewsByRestaurantId(c.UserContext(), &proto.GetReviewsByRestaurantRequest{
 		RestaurantId: c.Params("restaurantId"),
 	})
 	if err != nil {
-		slog.Warn("Failed to retrieve reviews", "error", err)
+		api.Logger(c).Warn("Failed to retrieve reviews", "error", err)
 		return api.ReturnError(c, err)
 	}
 
-	return c.JSON(response.Reviews)
+	return h.sendReviews(c, response.Reviews, q)
 }
 
-// GetReviewsByFoodId retrieves all reviews for a specific restaurant.
+// GetReviewsByFoodId retrieves a page of reviews for a specific food, see
+// listQuery.
 func (h *ReviewHandler) GetReviewsByFoodId(c *fiber.Ctx) error {
-	_, err := h.foodService.GetFoodByFoodId(c.Context(), &proto.FoodIdRequest{
+	q, errs := h.parseListQuery(c, "food/"+c.Params("foodId"))
+	if len(errs) > 0 {
+		return api.ValidationError(c, errs)
+	}
+
+	_, err := h.foodService.GetFoodByFoodId(c.UserContext(), &proto.FoodIdRequest{
 		Id: c.Params("foodId"),
 	})
 	if err != nil {
-		slog.Warn("Failed to get food", "error", err)
+		api.Logger(c).Warn("Failed to get food", "error", err)
 		return api.ReturnError(c, err)
 	}
 
-	response, err := h.reviewService.GetReviewsByFoodId(c.Context(), &proto.GetReviewsByFoodRequest{
+	response, err := h.reviewService.GetReviewsByFoodId(c.UserContext(), &proto.GetReviewsByFoodRequest{
 		FoodId: c.Params("foodId"),
 	})
 	if err != nil {
-		slog.Warn("Failed to retrieve reviews", "error", err)
+		api.Logger(c).Warn("Failed to retrieve reviews", "error", err)
+		return api.ReturnError(c, err)
+	}
+
+	return h.sendReviews(c, response.Reviews, q)
+}
+
+// GetFoodRating summarises the ratings of a food. Whether the food exists is
+// only checked on a cache miss, since the review service reports an unknown
+// food as one without reviews.
+func (h *ReviewHandler) GetFoodRating(c *fiber.Ctx) error {
+	if summary, ok := h.ratings.CachedFood(c.Params("foodId")); ok {
+		return c.JSON(summary)
+	}
+
+	_, err := h.foodService.GetFoodByFoodId(c.UserContext(), &proto.FoodIdRequest{
+		Id: c.Params("foodId"),
+	})
+	if err != nil {
+		api.Logger(c).Warn("Failed to get food", "error", err)
+		return api.ReturnError(c, err)
+	}
+
+	summary, err := h.ratings.Food(c.UserContext(), c.Params("foodId"))
+	if err != nil {
+		api.Logger(c).Warn("Failed to summarise ratings", "error", err)
+		return api.ReturnError(c, err)
+	}
+
+	return c.JSON(summary)
+}
+
+// GetRestaurantRating summarises the ratings of a restaurant, see
+// GetFoodRating.
+func (h *ReviewHandler) GetRestaurantRating(c *fiber.Ctx) error {
+	if summary, ok := h.ratings.CachedRestaurant(c.Params("restaurantId")); ok {
+		return c.JSON(summary)
+	}
+
+	_, err := h.foodService.GetRestaurantByRestaurantId(c.UserContext(), &proto.RestaurantIdRequest{
+		Id: c.Params("restaurantId"),
+	})
+	if err != nil {
+		api.Logger(c).Warn("Failed to get restaurant", "error", err)
 		return api.ReturnError(c, err)
 	}
 
-	return c.JSON(response.Reviews)
+	summary, err := h.ratings.Restaurant(c.UserContext(), c.Params("restaurantId"))
+	if err != nil {
+		api.Logger(c).Warn("Failed to summarise ratings", "error", err)
+		return api.ReturnError(c, err)
+	}
+
+	return c.JSON(summary)
 }
 
 // GetReview retrieves a specific review by its ID.
 func (h *ReviewHandler) GetReview(c *fiber.Ctx) error {
-	response, err := h.reviewService.GetReview(c.Context(), &proto.GetReviewRequest{
+	response, err := h.reviewService.GetReview(c.UserContext(), &proto.GetReviewRequest{
 		ReviewId: c.Params("reviewId"),
 	})
 	if err != nil {
-		slog.Warn("Failed to retrieve review", "error", err)
+		api.Logger(c).Warn("Failed to retrieve review", "error", err)
 		return api.ReturnError(c, err)
 	}
 
@@ -101,127 +179,137 @@ func (h *ReviewHandler) GetReview(c *fiber.Ctx) error {
 
 // UpdateReview updates an existing review.
 func (h *ReviewHandler) UpdateReview(c *fiber.Ctx) error {
-	claim, err := h.verify.Verify(api.GetAuthToken(c))
-	if err != nil {
-		slog.Warn("Failed to verify token", "error", err)
-		return api.Unauthorized(c)
-	}
+	claim := api.MustGetClaims(c)
 
 	review := new(proto.UpdateReviewRequest)
 	if err := c.BodyParser(review); err != nil {
-		slog.Warn("Failed to parse body", "error", err)
+		api.Logger(c).Warn("Failed to parse body", "error", err)
 		return api.BadRequest(c)
 	}
 
 	review.ReviewId = c.Params("reviewId")
 	review.UserId = int32(claim.UserId)
 	review.IsAdmin = claim.IsAdmin
-	response, err := h.reviewService.UpdateReview(c.Context(), review)
+	response, err := h.reviewService.UpdateReview(c.UserContext(), review)
 
 	if err != nil {
-		slog.Warn("Failed to update review", "error", err)
+		api.Logger(c).Warn("Failed to update review", "error", err)
 		return api.ReturnError(c, err)
 	}
+	h.ratings.Invalidate(response.FoodId, response.RestaurantId)
+	if response.FoodId != "" {
+		h.popular.RecordRating(response.ReviewId, response.FoodId, response.Rating)
+	}
 
 	return c.JSON(response)
 }
 
 // DeleteReview deletes a review by its ID.
 func (h *ReviewHandler) DeleteReview(c *fiber.Ctx) error {
-	claim, err := h.verify.Verify(api.GetAuthToken(c))
+	claim := api.MustGetClaims(c)
+
+	// The review is looked up first only to retract its rating from the
+	// recommender and the rating summaries, so failing to find it is left to
+	// DeleteReview to report.
+	review, err := h.reviewService.GetReview(c.UserContext(), &proto.GetReviewRequest{
+		ReviewId: c.Params("reviewId"),
+	})
 	if err != nil {
-		slog.Warn("Failed to verify token", "error", err)
-		return api.Unauthorized(c)
+		api.Logger(c).Warn("Failed to retrieve review", "error", err)
 	}
 
-	_, err = h.reviewService.DeleteReview(c.Context(), &proto.DeleteReviewRequest{
+	_, err = h.reviewService.DeleteReview(c.UserContext(), &proto.DeleteReviewRequest{
 		ReviewId: c.Params("reviewId"),
 		UserId:   int32(claim.UserId),
 		IsAdmin:  claim.IsAdmin,
 	})
 	if err != nil {
-		slog.Warn("Failed to delete review", "error", err)
+		api.Logger(c).Warn("Failed to delete review", "error", err)
 		return api.ReturnError(c, err)
 	}
+	if review != nil {
+		h.emitRating(c, review, true)
+		h.ratings.Invalidate(review.FoodId, review.RestaurantId)
+		h.popular.RemoveRating(review.ReviewId)
+	}
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
 // AddFavoriteFood adds a food item to the user's list of favorites.
 func (h *ReviewHandler) AddFavoriteFood(c *fiber.Ctx) error {
-	claim, err := h.verify.Verify(api.GetAuthToken(c))
-	if err != nil {
-		slog.Warn("Failed to verify token", "error", err)
-		return api.Unauthorized(c)
-	}
+	claim := api.MustGetClaims(c)
 	foodId := c.Params("foodId")
-	food, err := h.foodService.GetFoodByFoodId(c.Context(), &proto.FoodIdRequest{
+	food, err := h.foodService.GetFoodByFoodId(c.UserContext(), &proto.FoodIdRequest{
 		Id: foodId,
 	})
 	if err != nil {
 		return api.ReturnError(c, err)
 	}
-	_, err = h.reviewService.AddFavoriteFood(c.Context(), &proto.AddFavoriteFoodRequest{
+	_, err = h.reviewService.AddFavoriteFood(c.UserContext(), &proto.AddFavoriteFoodRequest{
 		UserId:       int32(claim.UserId),
 		FoodId:       foodId,
 		RestaurantId: food.RestaurantId,
 	})
 	if err != nil {
-		slog.Warn("Failed to add favorite food", "error", err)
+		api.Logger(c).Warn("Failed to add favorite food", "error", err)
 		return api.ReturnError(c, err)
 	}
+	h.events.Emit(c.UserContext(), events.Event{
+		Type:   proto.EventType_FAVORITE,
+		UserID: int64(claim.UserId),
+		ItemID: foodId,
+	})
 
 	return c.SendStatus(fiber.StatusCreated)
 }
 
 // RemoveFavoriteFood removes a food item from the user's list of favorites.
 func (h *ReviewHandler) RemoveFavoriteFood(c *fiber.Ctx) error {
-	claim, err := h.verify.Verify(api.GetAuthToken(c))
-	if err != nil {
-		slog.Warn("Failed to verify token", "error", err)
-		return api.Unauthorized(c)
-	}
+	claim := api.MustGetClaims(c)
 
 	foodId := c.Params("foodId")
-	food, err := h.foodService.GetFoodByFoodId(c.Context(), &proto.FoodIdRequest{
+	food, err := h.foodService.GetFoodByFoodId(c.UserContext(), &proto.FoodIdRequest{
 		Id: foodId,
 	})
 	if err != nil {
 		return api.ReturnError(c, err)
 	}
-	_, err = h.reviewService.RemoveFavoriteFood(c.Context(), &proto.RemoveFavoriteFoodRequest{
+	_, err = h.reviewService.RemoveFavoriteFood(c.UserContext(), &proto.RemoveFavoriteFoodRequest{
 		UserId:       int32(claim.UserId),
 		FoodId:       foodId,
 		RestaurantId: food.RestaurantId,
 	})
 	if err != nil {
-		slog.Warn("Failed to remove favorite food", "error", err)
+		api.Logger(c).Warn("Failed to remove favorite food", "error", err)
 		return api.ReturnError(c, err)
 	}
+	h.events.Emit(c.UserContext(), events.Event{
+		Type:   proto.EventType_FAVORITE,
+		UserID: int64(claim.UserId),
+		ItemID: foodId,
+		Remove: true,
+	})
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
 // GetFavoriteFoodsByUserId retrieves a list of the user's favorite foods.
 func (h *ReviewHandler) GetFavoriteFoodsByUserId(c *fiber.Ctx) error {
-	claim, err := h.verify.Verify(api.GetAuthToken(c))
-	if err != nil {
-		slog.Warn("Failed to verify token", "error", err)
-		return api.Unauthorized(c)
-	}
+	claim := api.MustGetClaims(c)
 
-	response, err := h.reviewService.GetFavoriteFoodsByUserId(c.Context(), &proto.GetFavoriteFoodsByUserIDRequest{
+	response, err := h.reviewService.GetFavoriteFoodsByUserId(c.UserContext(), &proto.GetFavoriteFoodsByUserIDRequest{
 		UserId: int32(claim.UserId),
 	})
 	if err != nil {
-		slog.Warn("Failed to retrieve favorite foods", "error", err)
+		api.Logger(c).Warn("Failed to retrieve favorite foods", "error", err)
 		return api.ReturnError(c, err)
 	}
 	foodIds := []string{}
 	for _, food := range response.FavoriteFoods {
 		foodIds = append(foodIds, food.FoodId)
 	}
-	foods, err := h.foodService.GetFoodsByFoodIds(c.Context(), &proto.FoodIdsRequest{
+	foods, err := h.foodService.GetFoodsByFoodIds(c.UserContext(), &proto.FoodIdsRequest{
 		Ids: foodIds,
 	})
 	if err != nil {
@@ -229,3 +317,18 @@ func (h *ReviewHandler) GetFavoriteFoodsByUserId(c *fiber.Ctx) error {
 	}
 	return c.JSON(foods)
 }
+
+// emitRating reports a rating to the recommender on behalf of the review's
+// author. Reviews of a restaurant as a whole carry no food to rate.
+func (h *ReviewHandler) emitRating(c *fiber.Ctx, review *proto.ReviewResponse, remove bool) {
+	if review.FoodId == "" {
+		return
+	}
+
+	h.events.Emit(c.UserContext(), events.Event{
+		Type:   proto.EventType_RATING,
+		UserID: int64(review.UserId),
+		ItemID: review.FoodId,
+		Remove: remove,
+	})
+}
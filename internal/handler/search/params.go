@@ -0,0 +1,152 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+)
+
+const (
+	maxSearchLength = 200
+	maxLimit        = 100
+)
+
+// searchParams are the parameters shared by every search. Pointers are nil
+// when the client did not send the parameter, in which case the search
+// service default applies.
+type searchParams struct {
+	Search string
+	Offset *int
+	Limit  *int
+}
+
+type foodSearchParams struct {
+	searchParams
+	MinPrice *float64
+	MaxPrice *float64
+}
+
+func parseSearchParams(c *fiber.Ctx) (searchParams, []api.FieldError) {
+	var (
+		p    searchParams
+		errs []api.FieldError
+	)
+
+	p.Search = c.Query("search")
+	if utf8.RuneCountInString(p.Search) > maxSearchLength {
+		errs = append(errs, api.FieldError{
+			Field:   "search",
+			Message: fmt.Sprintf("must be at most %d characters", maxSearchLength),
+		})
+	}
+
+	offset, err := queryInt(c, "offset")
+	switch {
+	case err != nil:
+		errs = append(errs, api.FieldError{Field: "offset", Message: "must be an integer"})
+	case offset != nil && *offset < 0:
+		errs = append(errs, api.FieldError{Field: "offset", Message: "must not be negative"})
+	default:
+		p.Offset = offset
+	}
+
+	limit, err := queryInt(c, "limit")
+	switch {
+	case err != nil:
+		errs = append(errs, api.FieldError{Field: "limit", Message: "must be an integer"})
+	case limit != nil && (*limit < 1 || *limit > maxLimit):
+		errs = append(errs, api.FieldError{
+			Field:   "limit",
+			Message: fmt.Sprintf("must be between 1 and %d", maxLimit),
+		})
+	default:
+		p.Limit = limit
+	}
+
+	return p, errs
+}
+
+func parseFoodSearchParams(c *fiber.Ctx) (foodSearchParams, []api.FieldError) {
+	base, errs := parseSearchParams(c)
+	p := foodSearchParams{searchParams: base}
+
+	minPrice, err := queryPrice(c, "minPrice")
+	if err != nil {
+		errs = append(errs, api.FieldError{Field: "minPrice", Message: err.Error()})
+	}
+	p.MinPrice = minPrice
+
+	maxPrice, err := queryPrice(c, "maxPrice")
+	if err != nil {
+		errs = append(errs, api.FieldError{Field: "maxPrice", Message: err.Error()})
+	}
+	p.MaxPrice = maxPrice
+
+	if p.MinPrice != nil && p.MaxPrice != nil && *p.MinPrice > *p.MaxPrice {
+		errs = append(errs, api.FieldError{Field: "minPrice", Message: "must not be greater than maxPrice"})
+	}
+
+	return p, errs
+}
+
+func (p searchParams) values() url.Values {
+	v := url.Values{}
+	v.Set("search", p.Search)
+	if p.Offset != nil {
+		v.Set("offset", strconv.Itoa(*p.Offset))
+	}
+	if p.Limit != nil {
+		v.Set("limit", strconv.Itoa(*p.Limit))
+	}
+
+	return v
+}
+
+func (p foodSearchParams) values() url.Values {
+	v := p.searchParams.values()
+	if p.MinPrice != nil {
+		v.Set("minPrice", strconv.FormatFloat(*p.MinPrice, 'f', -1, 64))
+	}
+	if p.MaxPrice != nil {
+		v.Set("maxPrice", strconv.FormatFloat(*p.MaxPrice, 'f', -1, 64))
+	}
+
+	return v
+}
+
+func queryInt(c *fiber.Ctx, key string) (*int, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+func queryPrice(c *fiber.Ctx, key string) (*float64, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, errors.New("must be a number")
+	}
+	if v < 0 {
+		return nil, errors.New("must not be negative")
+	}
+
+	return &v, nil
+}
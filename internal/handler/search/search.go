@@ -1,38 +1,38 @@
 package search
 
 import (
-	"fmt"
-
 	"github.com/gofiber/fiber/v2"
 	"github.com/mummumgoodboy/gateway/internal/api"
 	"github.com/mummumgoodboy/gateway/internal/config"
 )
 
-// Act as a gateway to the search service
+// Act as a gateway to the search service. Only the validated search
+// parameters are forwarded, never the raw inbound query.
 type SearchHandler struct {
-	cfg *config.Config
+	cfg   *config.Config
+	proxy *api.Proxy
 }
 
-func NewSearchHandler(cfg *config.Config) *SearchHandler {
-	return &SearchHandler{cfg: cfg}
+func NewSearchHandler(cfg *config.Config, proxy *api.Proxy) *SearchHandler {
+	return &SearchHandler{cfg: cfg, proxy: proxy}
 }
 
 func (h *SearchHandler) SearchRestaurants(c *fiber.Ctx) error {
-	searchQuery := c.Query("search")
-	offset := c.Query("offset")
-	limit := c.Query("limit")
+	params, errs := parseSearchParams(c)
+	if len(errs) > 0 {
+		return api.ValidationError(c, errs)
+	}
 
-	url := fmt.Sprintf("%s/search/restaurants?search=%s&offset=%s&limit=%s", h.cfg.SearchConfig.SearchServiceAddr, searchQuery, offset, limit)
-	return api.HandleRedirect(url, c)
+	url := h.cfg.SearchConfig.SearchServiceAddr + "/search/restaurants?" + params.values().Encode()
+	return h.proxy.HandleRedirectExact(url, c)
 }
 
 func (h *SearchHandler) SearchFoods(c *fiber.Ctx) error {
-	searchQuery := c.Query("search")
-	offset := c.Query("offset")
-	limit := c.Query("limit")
-	maxPrice := c.Query("maxPrice")
-	minPrice := c.Query("minPrice")
+	params, errs := parseFoodSearchParams(c)
+	if len(errs) > 0 {
+		return api.ValidationError(c, errs)
+	}
 
-	url := fmt.Sprintf("%s/search/foods?search=%s&offset=%s&limit=%s&maxPrice=%s&minPrice=%s", h.cfg.SearchConfig.SearchServiceAddr, searchQuery, offset, limit, maxPrice, minPrice)
-	return api.HandleRedirect(url, c)
+	url := h.cfg.SearchConfig.SearchServiceAddr + "/search/foods?" + params.values().Encode()
+	return h.proxy.HandleRedirectExact(url, c)
 }
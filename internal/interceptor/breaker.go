@@ -0,0 +1,43 @@
+package interceptor
+
+import (
+	"context"
+
+	"github.com/mummumgoodboy/gateway/package/breaker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// CircuitBreaker fails calls fast with codes.Unavailable while b is open or
+// its bulkhead is full. Health checks bypass b so that readiness keeps
+// reporting the real state of the upstream.
+func CircuitBreaker(b *breaker.Breaker) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if method == grpc_health_v1.Health_Check_FullMethodName {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		done, err := b.Allow()
+		if err != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		done(!isUpstreamFailure(err))
+
+		return err
+	}
+}
+
+// isUpstreamFailure tells errors caused by an unhealthy upstream apart from
+// ones caused by the request itself.
+func isUpstreamFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown, codes.ResourceExhausted:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,49 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	grpcRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_grpc_client_requests_total",
+		Help: "Number of gRPC calls made to upstream services.",
+	}, []string{"service", "method", "code"})
+	grpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_grpc_client_request_duration_seconds",
+		Help:    "Latency of gRPC calls made to upstream services.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "method", "code"})
+)
+
+// Metrics records the count and latency of every unary call by service,
+// method and status code.
+func Metrics() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		service, name := splitMethod(method)
+		code := status.Code(err).String()
+		grpcRequests.WithLabelValues(service, name, code).Inc()
+		grpcDuration.WithLabelValues(service, name, code).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// splitMethod splits "/package.Service/Method" into its service and method.
+func splitMethod(fullMethod string) (string, string) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return "unknown", fullMethod
+	}
+	return service, method
+}
@@ -0,0 +1,21 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestID forwards the ID of the inbound request in the x-request-id
+// metadata key.
+func RequestID() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if id := api.RequestIDFromContext(ctx); id != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(api.HeaderRequestID), id)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
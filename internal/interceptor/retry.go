@@ -0,0 +1,46 @@
+package interceptor
+
+import (
+	"context"
+
+	"github.com/mummumgoodboy/gateway/package/retry"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var grpcRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_grpc_client_retries_total",
+	Help: "Number of gRPC calls retried after a transient failure.",
+}, []string{"service", "method"})
+
+// Retry retries calls to methods that fail with codes.Unavailable, backing
+// off as p describes. Only idempotent methods may be listed; every other call
+// is made exactly once. Retries never outlive the deadline of ctx.
+func Retry(p retry.Policy, methods ...string) grpc.UnaryClientInterceptor {
+	idempotent := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		idempotent[m] = true
+	}
+
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !idempotent[method] {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		for attempt := 1; ; attempt++ {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if status.Code(err) != codes.Unavailable || attempt >= p.MaxAttempts || !p.Wait(ctx, attempt) {
+				return err
+			}
+
+			service, name := splitMethod(method)
+			grpcRetries.WithLabelValues(service, name).Inc()
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Int("rpc.retry_count", attempt))
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"github.com/mummumgoodboy/verify"
+)
+
+// Policy describes who is allowed to call a route.
+type Policy int
+
+const (
+	// PolicyPublic does not look at the Authorization header at all.
+	PolicyPublic Policy = iota
+	// PolicyOptional verifies the token when one is sent, so handlers can
+	// personalise the response, but lets anonymous requests through.
+	PolicyOptional
+	// PolicyLenient is PolicyOptional for routes that must keep working for
+	// clients holding a stale session: an invalid or expired token is
+	// treated as no token at all.
+	PolicyLenient
+	// PolicyUser requires a valid token.
+	PolicyUser
+	// PolicyAdmin requires a valid token that belongs to an admin.
+	PolicyAdmin
+)
+
+type AuthMiddleware struct {
+	verify *verify.JWTVerifier
+}
+
+func NewAuthMiddleware(verifier *verify.JWTVerifier) *AuthMiddleware {
+	return &AuthMiddleware{verify: verifier}
+}
+
+// Policy returns a handler that verifies the JWT at most once per request,
+// stores the claims for api.GetClaims and enforces p.
+func (m *AuthMiddleware) Policy(p Policy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if p == PolicyPublic {
+			return c.Next()
+		}
+
+		if _, ok := api.GetClaims(c); ok {
+			return m.enforce(c, p)
+		}
+
+		token := api.GetAuthToken(c)
+		if token == "" {
+			if p == PolicyOptional || p == PolicyLenient {
+				return c.Next()
+			}
+			return api.Unauthorized(c)
+		}
+
+		claim, err := m.verify.Verify(token)
+		if err != nil {
+			api.Logger(c).Warn("Failed to verify token",
+				"error", err,
+			)
+			if p == PolicyLenient {
+				return c.Next()
+			}
+			return api.Unauthorized(c)
+		}
+		api.SetClaims(c, claim)
+
+		return m.enforce(c, p)
+	}
+}
+
+func (m *AuthMiddleware) enforce(c *fiber.Ctx, p Policy) error {
+	claim, _ := api.GetClaims(c)
+	if p == PolicyAdmin && !claim.IsAdmin {
+		api.Logger(c).Warn("User is not admin",
+			"user", claim.UserId,
+		)
+		return api.Forbidden(c)
+	}
+
+	return c.Next()
+}
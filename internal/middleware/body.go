@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+)
+
+// BufferBody reads a streamed request body into memory so that handlers can
+// parse it, answering 413 once it grows past limit. With StreamRequestBody,
+// fasthttp streams large bodies instead of rejecting them, so any route that
+// is not a proxy must use it.
+func BufferBody(limit int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !c.Request().IsBodyStream() {
+			return c.Next()
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request().BodyStream(), int64(limit)+1))
+		if err != nil {
+			return api.ReturnError(c, err)
+		}
+		if len(body) > limit {
+			c.Context().SetConnectionClose()
+			return api.RequestEntityTooLarge(c)
+		}
+		c.Request().SetBody(body)
+
+		return c.Next()
+	}
+}
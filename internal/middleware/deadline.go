@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"github.com/mummumgoodboy/gateway/internal/config"
+)
+
+type routeTimeout struct {
+	method   string
+	segments []string
+	timeout  time.Duration
+}
+
+// Deadline gives every request a time budget that upstream calls made with
+// c.UserContext() inherit. The budget is cfg.Request unless one of
+// cfg.Routes matches, keyed by method and route template such as
+// "GET /food/:foodId".
+//
+// The context is also cancelled when the handler returns and, where the
+// platform allows it, when the client hangs up. It is not cancelled on
+// shutdown, which lets in-flight requests drain. fasthttp does not report
+// disconnects while a handler runs, so the connection is polled every
+// cfg.DisconnectPoll instead, see watchDisconnect. Proxied calls, which
+// outlive the handler, observe the disconnect through
+// api.ContextWithDisconnect.
+func Deadline(cfg config.TimeoutConfig) fiber.Handler {
+	routes := make([]routeTimeout, 0, len(cfg.Routes))
+	for key, timeout := range cfg.Routes {
+		method, template, ok := strings.Cut(strings.TrimSpace(key), " ")
+		if !ok {
+			method, template = "", key
+		}
+		routes = append(routes, routeTimeout{
+			method:   strings.ToUpper(method),
+			segments: splitPath(template),
+			timeout:  timeout,
+		})
+	}
+
+	return func(c *fiber.Ctx) error {
+		budget := cfg.Request
+		path := splitPath(c.Path())
+		for _, r := range routes {
+			if (r.method == "" || r.method == c.Method()) && matchSegments(r.segments, path) {
+				budget = r.timeout
+				break
+			}
+		}
+
+		gone, hungUp := context.WithCancel(context.Background())
+		ctx, cancel := context.WithTimeout(c.UserContext(), budget)
+		defer cancel()
+
+		stopWatch := watchDisconnect(c.Context().Conn(), cfg.DisconnectPoll, func() {
+			hungUp()
+			cancel()
+		})
+		defer stopWatch()
+
+		ctx = api.ContextWithDisconnect(ctx, gone)
+
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
+
+func splitPath(p string) []string {
+	return strings.Split(strings.Trim(strings.ToLower(p), "/"), "/")
+}
+
+// matchSegments matches a path against a route template whose :param
+// segments match any single path segment.
+func matchSegments(template, path []string) bool {
+	if len(template) != len(path) {
+		return false
+	}
+	for i, seg := range template {
+		if !strings.HasPrefix(seg, ":") && seg != path[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// watchDisconnect calls cancel once the client has closed conn, checking
+// every interval until the returned func is called. It does nothing when
+// interval is not positive or conn cannot be probed on this platform.
+func watchDisconnect(conn net.Conn, interval time.Duration, cancel context.CancelFunc) (stop func()) {
+	closed := closeProbe(conn)
+	if interval <= 0 || closed == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if closed() {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package middleware
+
+import "net"
+
+// closeProbe cannot tell whether the client left on this platform.
+func closeProbe(net.Conn) func() bool {
+	return nil
+}
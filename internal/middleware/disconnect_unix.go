@@ -0,0 +1,41 @@
+//go:build unix
+
+package middleware
+
+import (
+	"crypto/tls"
+	"net"
+	"syscall"
+)
+
+// closeProbe peeks at the socket of conn without consuming any byte. A read
+// of zero bytes means the client has sent FIN, so a client that only shuts
+// down its writing side is taken as gone too. Bytes already waiting, such as
+// a pipelined request, mean it is still there.
+func closeProbe(conn net.Conn) func() bool {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+
+	return func() bool {
+		var closed bool
+		err := rc.Read(func(fd uintptr) bool {
+			var buf [1]byte
+			// The runtime keeps sockets non-blocking, so this returns EAGAIN
+			// rather than waiting when nothing has arrived.
+			n, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK)
+			closed = (err == nil && n == 0) || err == syscall.ECONNRESET
+			return true
+		})
+		// The gateway itself closed the connection.
+		return closed || err != nil
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_http_requests_total",
+		Help: "Number of HTTP requests served by the gateway.",
+	}, []string{"method", "route", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests served by the gateway.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Metrics records every request by route template, e.g. /food/:foodId, so
+// that path parameters do not blow up the number of series.
+func Metrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := handleError(c, c.Next())
+
+		route := registeredRoutes.template(c)
+		class := StatusClass(c.Response().StatusCode())
+		httpRequests.WithLabelValues(c.Method(), route, class).Inc()
+		httpDuration.WithLabelValues(c.Method(), route, class).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// StatusClass groups HTTP status codes as 2xx, 4xx, ...
+func StatusClass(code int) string {
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// routeSet knows the templates of the routes registered on the app, which
+// is only complete once the app serves its first request.
+type routeSet struct {
+	once   sync.Once
+	routes map[string]bool
+}
+
+var registeredRoutes routeSet
+
+// template returns the path template of the route that served the request.
+// Requests that fell through every route only matched global middleware.
+func (s *routeSet) template(c *fiber.Ctx) string {
+	s.once.Do(func() {
+		s.routes = map[string]bool{}
+		for _, r := range c.App().GetRoutes(true) {
+			s.routes[r.Method+" "+r.Path] = true
+		}
+	})
+
+	r := c.Route()
+	if !s.routes[r.Method+" "+r.Path] {
+		return "unmatched"
+	}
+	return r.Path
+}
+
+// handleError renders err with the app error handler so that middleware
+// running after the handler sees the final status code.
+func handleError(c *fiber.Ctx, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if err := c.App().ErrorHandler(c, err); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const maxRequestIDLength = 128
+
+// RequestID accepts the client's X-Request-ID or assigns a new one, echoes
+// it back and attaches it to the request logger and context so that it is
+// forwarded to upstreams.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(api.HeaderRequestID)
+		if !validRequestID(id) {
+			id = utils.UUIDv4()
+		}
+		c.Set(api.HeaderRequestID, id)
+
+		ctx := api.ContextWithRequestID(c.UserContext(), id)
+		c.SetUserContext(ctx)
+
+		logger := slog.Default().With("request_id", id)
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		api.SetLogger(c, logger)
+
+		return c.Next()
+	}
+}
+
+// validRequestID rejects IDs that could be used to forge log lines or
+// headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLog writes one line per request once the response is known.
+func AccessLog() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := handleError(c, c.Next())
+
+		attrs := []any{
+			"method", c.Method(),
+			"route", registeredRoutes.template(c),
+			"path", c.Path(),
+			"status", c.Response().StatusCode(),
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"bytes", responseSize(c),
+			"ip", c.IP(),
+		}
+		if claim, ok := api.GetClaims(c); ok {
+			attrs = append(attrs, "user_id", claim.UserId)
+		}
+		api.Logger(c).Info("Request handled", attrs...)
+
+		return err
+	}
+}
+
+// responseSize avoids reading streamed bodies, whose size is only known when
+// the upstream sent a Content-Length.
+func responseSize(c *fiber.Ctx) int {
+	if c.Response().IsBodyStream() {
+		return c.Response().Header.ContentLength()
+	}
+	return len(c.Response().Body())
+}
@@ -0,0 +1,208 @@
+// Package popular ranks foods by how often they were recently recommended
+// and how well they were rated, to stand in for the recommender while it is
+// unavailable.
+package popular
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mummumgoodboy/gateway/internal/config"
+)
+
+// ratingWeight makes a five star rating count as much as being the top
+// recommendation five times.
+const ratingWeight = 5
+
+// forgetHalfLives is how many half-lives a rating is remembered for, after
+// which its credit is too small to be worth taking back.
+const forgetHalfLives = 10
+
+type entry struct {
+	score   float64
+	updated time.Time
+}
+
+// rated is the credit a review gave its food, remembered so that it can be
+// taken back when the review changes.
+type rated struct {
+	foodID string
+	credit float64
+	at     time.Time
+}
+
+// Store keeps a score per food that decays exponentially, so recent activity
+// outweighs old.
+type Store struct {
+	halfLife time.Duration
+	maxItems int
+
+	mu        sync.Mutex
+	scores    map[string]*entry
+	reviews   map[string]rated
+	lastSweep time.Time
+}
+
+func NewStore(cfg config.FallbackConfig) *Store {
+	return &Store{
+		halfLife:  cfg.HalfLife,
+		maxItems:  cfg.MaxItems,
+		scores:    map[string]*entry{},
+		reviews:   map[string]rated{},
+		lastSweep: time.Now(),
+	}
+}
+
+// RecordRecommendations credits the items of a recommender response, the
+// first one the most.
+func (s *Store) RecordRecommendations(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for rank, id := range ids {
+		s.add(id, 1/float64(rank+1), now)
+	}
+	s.prune(now)
+}
+
+// RecordRating credits a food with the rating out of 5 of a review, taking
+// back what an earlier rating of the same review gave. Ratings below 3 count
+// against the food.
+func (s *Store) RecordRating(reviewID, foodID string, rating float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.retract(reviewID, now)
+	s.rate(reviewID, foodID, rating, now, now)
+	s.prune(now)
+}
+
+// RemoveRating takes back what the rating of a deleted review gave its food.
+func (s *Store) RemoveRating(reviewID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.retract(reviewID, time.Now())
+}
+
+// Top returns up to limit food IDs after skipping offset, best first. Foods
+// whose score is not positive are left out. A negative offset counts as
+// zero.
+func (s *Store) Top(limit, offset int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ranked := s.ranked(time.Now())
+	n := 0
+	for n < len(ranked) && ranked[n].score > 0 {
+		n++
+	}
+	ranked = ranked[:n]
+
+	offset = max(offset, 0)
+	if offset >= len(ranked) || limit <= 0 {
+		return []string{}
+	}
+	ranked = ranked[offset:min(offset+limit, len(ranked))]
+
+	ids := make([]string, len(ranked))
+	for i, r := range ranked {
+		ids[i] = r.id
+	}
+	return ids
+}
+
+type scored struct {
+	id    string
+	score float64
+}
+
+// ranked returns every food with its score decayed to now, best first.
+// s.mu must be held.
+func (s *Store) ranked(now time.Time) []scored {
+	res := make([]scored, 0, len(s.scores))
+	for id, e := range s.scores {
+		res = append(res, scored{id: id, score: s.decayed(e, now)})
+	}
+	slices.SortFunc(res, func(a, b scored) int {
+		if a.score != b.score {
+			if a.score > b.score {
+				return -1
+			}
+			return 1
+		}
+		if a.id < b.id {
+			return -1
+		}
+		return 1
+	})
+
+	return res
+}
+
+func (s *Store) decayed(e *entry, now time.Time) float64 {
+	if s.halfLife <= 0 {
+		return e.score
+	}
+	return e.score * math.Exp2(-float64(now.Sub(e.updated))/float64(s.halfLife))
+}
+
+// rate credits foodID with a rating given at, decayed to now. s.mu must be
+// held.
+func (s *Store) rate(reviewID, foodID string, rating float32, at, now time.Time) {
+	credit := ratingWeight * (float64(rating) - 2.5) / 2.5
+	s.add(foodID, s.decayed(&entry{score: credit, updated: at}, now), now)
+	s.reviews[reviewID] = rated{foodID: foodID, credit: credit, at: at}
+}
+
+// retract takes back the credit of reviewID, if it is remembered. s.mu must
+// be held.
+func (s *Store) retract(reviewID string, now time.Time) {
+	r, ok := s.reviews[reviewID]
+	if !ok {
+		return
+	}
+	delete(s.reviews, reviewID)
+	s.add(r.foodID, -s.decayed(&entry{score: r.credit, updated: r.at}, now), now)
+	// Rounding leaves a trace of a food whose only rating was taken back.
+	if math.Abs(s.scores[r.foodID].score) < 1e-9 {
+		delete(s.scores, r.foodID)
+	}
+}
+
+// add must be called with s.mu held.
+func (s *Store) add(id string, v float64, now time.Time) {
+	e, ok := s.scores[id]
+	if !ok {
+		s.scores[id] = &entry{score: v, updated: now}
+		return
+	}
+	e.score = s.decayed(e, now) + v
+	e.updated = now
+}
+
+// prune forgets ratings too old to be taken back and drops the lowest scores
+// once the store has grown a tenth past its limit, so that the sort is not
+// paid on every update. s.mu must be held.
+func (s *Store) prune(now time.Time) {
+	if s.halfLife > 0 && now.Sub(s.lastSweep) >= s.halfLife {
+		for id, r := range s.reviews {
+			if now.Sub(r.at) >= forgetHalfLives*s.halfLife {
+				delete(s.reviews, id)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if s.maxItems <= 0 || len(s.scores) <= s.maxItems+s.maxItems/10 {
+		return
+	}
+
+	for _, r := range s.ranked(now)[s.maxItems:] {
+		delete(s.scores, r.id)
+	}
+}
@@ -0,0 +1,73 @@
+package popular
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mummumgoodboy/gateway/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// seedConcurrency bounds the review calls in flight while seeding, so that
+// seeding leaves room in the review service's bulkhead for requests.
+const seedConcurrency = 4
+
+// Seed credits the store with the ratings of every review still recent
+// enough to count, as if it had been running when they were made. The store
+// is otherwise empty after a restart, and popular foods are only served when
+// the recommender is down, which is when they are needed the most.
+//
+// Reviews recorded while seeding are not counted twice. Restaurants whose
+// reviews cannot be read are skipped and reported in the returned error.
+func (s *Store) Seed(ctx context.Context, foodService proto.RestaurantFoodClient, reviewService proto.ReviewClient) error {
+	res, err := foodService.GetRestaurants(ctx, &emptypb.Empty{})
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(res.Restaurants))
+	sem := make(chan struct{}, seedConcurrency)
+	var wg sync.WaitGroup
+	for i, r := range res.Restaurants {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			reviews, err := reviewService.GetReviewsByRestaurantId(ctx, &proto.GetReviewsByRestaurantRequest{
+				RestaurantId: r.Id,
+			})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			s.seed(reviews.Reviews)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (s *Store) seed(reviews []*proto.ReviewResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, r := range reviews {
+		at := r.GetCreatedAt().AsTime()
+		// Reviews of a restaurant as a whole carry no food.
+		if r.FoodId == "" || (s.halfLife > 0 && now.Sub(at) >= forgetHalfLives*s.halfLife) {
+			continue
+		}
+		if _, ok := s.reviews[r.ReviewId]; ok {
+			continue
+		}
+		s.rate(r.ReviewId, r.FoodId, r.Rating, at, now)
+	}
+	s.prune(now)
+}
@@ -0,0 +1,161 @@
+// Package profile looks up the public profiles of users in the auth service.
+//
+// The auth service is expected to serve
+//
+//	GET /users?ids=1,2,3
+//	Authorization: Bearer <AUTH_SERVICE_TOKEN>
+//
+// with 200 and a JSON array holding one object per known user, in any order:
+//
+//	[{"id": 1, "username": "alice", "avatar_url": "https://..."}]
+//
+// Unknown IDs are left out of the array rather than failing the request.
+// avatar_url is optional and other fields are ignored. Any other status, or
+// a user without id or username, or one that was not asked for, fails the
+// whole batch with api.ErrBadGateway.
+package profile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mummumgoodboy/gateway/internal/api"
+	"github.com/mummumgoodboy/gateway/internal/config"
+)
+
+// Profile holds the fields of a user that anyone may see. The auth service
+// returns more, which are dropped when decoding.
+type Profile struct {
+	ID        uint   `json:"id"`
+	Username  string `json:"username"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+}
+
+type entry struct {
+	// profile is nil for users the auth service does not know.
+	profile *Profile
+	expires time.Time
+}
+
+// Store fetches profiles in batch, see the package documentation, and
+// caches them for a short while.
+type Store struct {
+	proxy      *api.Proxy
+	enabled    bool
+	url        string
+	token      string
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[uint]entry
+}
+
+func NewStore(cfg *config.Config, proxy *api.Proxy) *Store {
+	return &Store{
+		proxy:      proxy,
+		enabled:    cfg.ProfileConfig.Enabled && cfg.AuthConfig.ServiceToken != "",
+		url:        cfg.AuthConfig.AuthServiceURL + "/users",
+		token:      cfg.AuthConfig.ServiceToken,
+		ttl:        cfg.ProfileConfig.CacheTTL,
+		maxEntries: cfg.ProfileConfig.CacheMaxEntries,
+		entries:    map[uint]entry{},
+	}
+}
+
+// Get returns the profiles of ids that exist, keyed by user ID. When lookups
+// are disabled or there is no service token, none are looked up.
+func (s *Store) Get(ctx context.Context, ids []uint) (map[uint]Profile, error) {
+	profiles := make(map[uint]Profile, len(ids))
+	if !s.enabled {
+		return profiles, nil
+	}
+	var missing []uint
+
+	s.mu.Lock()
+	now := time.Now()
+	for _, id := range ids {
+		e, ok := s.entries[id]
+		switch {
+		case !ok || now.After(e.expires):
+			missing = append(missing, id)
+		case e.profile != nil:
+			profiles[id] = *e.profile
+		}
+	}
+	s.mu.Unlock()
+
+	if len(missing) == 0 {
+		return profiles, nil
+	}
+
+	fetched, err := s.fetch(ctx, missing)
+	if err != nil {
+		return profiles, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now = time.Now()
+	if len(s.entries)+len(missing) > s.maxEntries {
+		for id, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, id)
+			}
+		}
+	}
+	for _, id := range missing {
+		e := entry{expires: now.Add(s.ttl)}
+		if p, ok := fetched[id]; ok {
+			profiles[id] = p
+			e.profile = &p
+		}
+		if len(s.entries) < s.maxEntries {
+			s.entries[id] = e
+		}
+	}
+
+	return profiles, nil
+}
+
+func (s *Store) fetch(ctx context.Context, ids []uint) (map[uint]Profile, error) {
+	raw := make([]string, 0, len(ids))
+	for _, id := range ids {
+		raw = append(raw, strconv.FormatUint(uint64(id), 10))
+	}
+
+	resp, err := s.proxy.Get(ctx, s.url+"?"+url.Values{"ids": {strings.Join(raw, ",")}}.Encode(), http.Header{
+		fiber.HeaderAuthorization: {"Bearer " + s.token},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: auth service answered %d", api.ErrBadGateway, resp.StatusCode)
+	}
+
+	var users []Profile
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		return nil, fmt.Errorf("%w: decoding profiles: %w", api.ErrBadGateway, err)
+	}
+
+	fetched := make(map[uint]Profile, len(users))
+	for _, u := range users {
+		if u.ID == 0 || u.Username == "" || !slices.Contains(ids, u.ID) {
+			return nil, fmt.Errorf("%w: unexpected profile of user %d", api.ErrBadGateway, u.ID)
+		}
+		fetched[u.ID] = u
+	}
+	return fetched, nil
+}
@@ -0,0 +1,176 @@
+// Package rating summarises the ratings of a food or restaurant.
+package rating
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/mummumgoodboy/gateway/internal/config"
+	"github.com/mummumgoodboy/gateway/proto"
+)
+
+type Summary struct {
+	// Average is rounded to two decimals, and zero without reviews.
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+	// Histogram counts reviews by star, from 1 to 5. Ratings are rounded
+	// to the nearest star.
+	Histogram map[int]int `json:"histogram"`
+}
+
+func Summarize(reviews []*proto.ReviewResponse) Summary {
+	s := Summary{Histogram: map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}}
+	var total float64
+	for _, r := range reviews {
+		total += float64(r.Rating)
+		s.Count++
+		star := min(max(int(math.Round(float64(r.Rating))), 1), 5)
+		s.Histogram[star]++
+	}
+	if s.Count > 0 {
+		s.Average = math.Round(total/float64(s.Count)*100) / 100
+	}
+
+	return s
+}
+
+type key struct {
+	restaurant bool
+	id         string
+}
+
+type entry struct {
+	summary Summary
+	expires time.Time
+}
+
+// Service serves summaries from a cache that expires after a TTL and is
+// invalidated when reviews change through this gateway. Changes made through
+// other replicas show up once the TTL has passed.
+type Service struct {
+	reviewService proto.ReviewClient
+	ttl           time.Duration
+	maxEntries    int
+
+	mu      sync.Mutex
+	entries map[key]entry
+	// epoch changes on every invalidation, so that a summary computed from
+	// reviews fetched before it is not cached.
+	epoch uint64
+}
+
+func NewService(cfg config.RatingConfig, reviewService proto.ReviewClient) *Service {
+	return &Service{
+		reviewService: reviewService,
+		ttl:           cfg.CacheTTL,
+		maxEntries:    cfg.CacheMaxEntries,
+		entries:       map[key]entry{},
+	}
+}
+
+func (s *Service) Food(ctx context.Context, foodID string) (Summary, error) {
+	if summary, ok := s.CachedFood(foodID); ok {
+		return summary, nil
+	}
+	summary, _, err := s.FoodReviews(ctx, foodID)
+	return summary, err
+}
+
+func (s *Service) Restaurant(ctx context.Context, restaurantID string) (Summary, error) {
+	if summary, ok := s.CachedRestaurant(restaurantID); ok {
+		return summary, nil
+	}
+	summary, _, err := s.RestaurantReviews(ctx, restaurantID)
+	return summary, err
+}
+
+// CachedFood returns the summary of foodID if it is cached.
+func (s *Service) CachedFood(foodID string) (Summary, bool) {
+	return s.cached(key{id: foodID})
+}
+
+// CachedRestaurant returns the summary of restaurantID if it is cached.
+func (s *Service) CachedRestaurant(restaurantID string) (Summary, bool) {
+	return s.cached(key{restaurant: true, id: restaurantID})
+}
+
+// FoodReviews fetches the reviews of foodID, for callers that need them
+// anyway, and caches their summary.
+func (s *Service) FoodReviews(ctx context.Context, foodID string) (Summary, []*proto.ReviewResponse, error) {
+	return s.refresh(key{id: foodID}, func() ([]*proto.ReviewResponse, error) {
+		res, err := s.reviewService.GetReviewsByFoodId(ctx, &proto.GetReviewsByFoodRequest{
+			FoodId: foodID,
+		})
+		return res.GetReviews(), err
+	})
+}
+
+// RestaurantReviews fetches the reviews of restaurantID, for callers that
+// need them anyway, and caches their summary.
+func (s *Service) RestaurantReviews(ctx context.Context, restaurantID string) (Summary, []*proto.ReviewResponse, error) {
+	return s.refresh(key{restaurant: true, id: restaurantID}, func() ([]*proto.ReviewResponse, error) {
+		res, err := s.reviewService.GetReviewsByRestaurantId(ctx, &proto.GetReviewsByRestaurantRequest{
+			RestaurantId: restaurantID,
+		})
+		return res.GetReviews(), err
+	})
+}
+
+// Invalidate drops the summaries a review of foodID at restaurantID counts
+// towards. Either ID may be empty.
+func (s *Service) Invalidate(foodID, restaurantID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.epoch++
+	if foodID != "" {
+		delete(s.entries, key{id: foodID})
+	}
+	if restaurantID != "" {
+		delete(s.entries, key{restaurant: true, id: restaurantID})
+	}
+}
+
+func (s *Service) cached(k key) (Summary, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[k]
+	if !ok || !time.Now().Before(e.expires) {
+		return Summary{}, false
+	}
+	return e.summary, true
+}
+
+func (s *Service) refresh(k key, fetch func() ([]*proto.ReviewResponse, error)) (Summary, []*proto.ReviewResponse, error) {
+	s.mu.Lock()
+	epoch := s.epoch
+	s.mu.Unlock()
+
+	reviews, err := fetch()
+	if err != nil {
+		return Summary{}, nil, err
+	}
+	summary := Summarize(reviews)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.epoch != epoch {
+		return summary, reviews, nil
+	}
+	now := time.Now()
+	if len(s.entries) >= s.maxEntries {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	if _, ok := s.entries[k]; ok || len(s.entries) < s.maxEntries {
+		s.entries[k] = entry{summary: summary, expires: now.Add(s.ttl)}
+	}
+
+	return summary, reviews, nil
+}
@@ -4,58 +4,95 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/mummumgoodboy/gateway/internal/handler/auth"
 	"github.com/mummumgoodboy/gateway/internal/handler/food"
+	"github.com/mummumgoodboy/gateway/internal/handler/health"
+	"github.com/mummumgoodboy/gateway/internal/handler/metrics"
 	"github.com/mummumgoodboy/gateway/internal/handler/recommend"
+	"github.com/mummumgoodboy/gateway/internal/handler/restaurant"
 	"github.com/mummumgoodboy/gateway/internal/handler/review"
 	"github.com/mummumgoodboy/gateway/internal/handler/search"
+	"github.com/mummumgoodboy/gateway/internal/middleware"
 )
 
 type Route struct {
-	AuthHandler      *auth.AuthHandler
-	FoodHandler      *food.FoodHandler
-	RecommendHandler *recommend.RecommendHandler
-	ReviewHandler    *review.ReviewHandler
-	SearchHandler    *search.SearchHandler
+	AuthMiddleware    *middleware.AuthMiddleware
+	BodyLimit         int
+	AuthHandler       *auth.AuthHandler
+	FoodHandler       *food.FoodHandler
+	HealthHandler     *health.HealthHandler
+	MetricsHandler    *metrics.MetricsHandler
+	RecommendHandler  *recommend.RecommendHandler
+	RestaurantHandler *restaurant.RestaurantHandler
+	ReviewHandler     *review.ReviewHandler
+	SearchHandler     *search.SearchHandler
 }
 
 func (r *Route) Apply(f fiber.Router) {
+	public := r.AuthMiddleware.Policy(middleware.PolicyPublic)
+	optional := r.AuthMiddleware.Policy(middleware.PolicyOptional)
+	lenient := r.AuthMiddleware.Policy(middleware.PolicyLenient)
+	user := r.AuthMiddleware.Policy(middleware.PolicyUser)
+	admin := r.AuthMiddleware.Policy(middleware.PolicyAdmin)
+	// Only the proxied auth and search routes stream request bodies.
+	buffered := middleware.BufferBody(r.BodyLimit)
+
+	f.Get("/healthz", public, r.HealthHandler.Liveness)
+	f.Get("/readyz", public, r.HealthHandler.Readiness)
+	f.Get("/metrics", public, r.MetricsHandler.GetMetrics)
+
+	// The auth service verifies its own tokens, so these are only proxied.
 	auth := f.Group("/auth")
-	auth.Post("/login", r.AuthHandler.Login)
-	auth.Post("/register", r.AuthHandler.Register)
-	auth.Get("/me", r.AuthHandler.GetMe)
-	auth.Put("/me", r.AuthHandler.UpdateProfile)
-	auth.Patch("/me/password", r.AuthHandler.ChangePassword)
-
-	food := f.Group("/food")
-	food.Get("/:foodId", r.FoodHandler.GetFood)
-	food.Post("/", r.FoodHandler.CreateFood)
-	food.Put("/:foodId", r.FoodHandler.UpdateFood)
-	food.Delete("/:foodId", r.FoodHandler.DeleteFood)
-	food.Get("/:foodId/reviews", r.ReviewHandler.GetReviewsByFoodId)
-
-	restaurant := f.Group("/restaurant")
-	restaurant.Get("/", r.FoodHandler.GetRestaurants)
-	restaurant.Get("/:restaurantId", r.FoodHandler.GetRestaurant)
-	restaurant.Post("/", r.FoodHandler.CreateRestaurant)
-	restaurant.Put("/:restaurantId", r.FoodHandler.UpdateRestaurant)
-	restaurant.Delete("/:restaurantId", r.FoodHandler.DeleteRestaurant)
-	restaurant.Get("/:restaurantId/foods", r.FoodHandler.GetFoodsByRestaurantId)
-	restaurant.Get("/:restaurantId/reviews", r.ReviewHandler.GetReviewsByRestaurantId)
-
-	review := f.Group("/review")
-	review.Get("/:reviewId", r.ReviewHandler.GetReview)
-	review.Post("/", r.ReviewHandler.CreateReview)
-	review.Put("/:reviewId", r.ReviewHandler.UpdateReview)
-	review.Delete("/:reviewId", r.ReviewHandler.DeleteReview)
-
-	favorite := f.Group("/favorite")
-	favorite.Post("/:foodId", r.ReviewHandler.AddFavoriteFood)
-	favorite.Delete("/:foodId", r.ReviewHandler.RemoveFavoriteFood)
-	favorite.Get("/", r.ReviewHandler.GetFavoriteFoodsByUserId)
-
-	foodRecommend := f.Group("/food-recommend")
-	foodRecommend.Get("/", r.RecommendHandler.GetRecommend)
+	auth.Post("/login", public, r.AuthHandler.Login)
+	auth.Post("/register", public, r.AuthHandler.Register)
+	auth.Get("/me", public, r.AuthHandler.GetMe)
+	auth.Put("/me", public, r.AuthHandler.UpdateProfile)
+	auth.Patch("/me/password", public, r.AuthHandler.ChangePassword)
+
+	food := f.Group("/food", buffered)
+	food.Get("/:foodId", lenient, r.FoodHandler.GetFood)
+	food.Post("/", admin, r.FoodHandler.CreateFood)
+	food.Put("/:foodId", admin, r.FoodHandler.UpdateFood)
+	food.Delete("/:foodId", admin, r.FoodHandler.DeleteFood)
+	food.Get("/:foodId/reviews", public, r.ReviewHandler.GetReviewsByFoodId)
+	food.Get("/:foodId/rating", public, r.ReviewHandler.GetFoodRating)
+
+	restaurant := f.Group("/restaurant", buffered)
+	restaurant.Get("/", public, r.FoodHandler.GetRestaurants)
+	restaurant.Get("/:restaurantId", public, r.FoodHandler.GetRestaurant)
+	restaurant.Post("/", admin, r.FoodHandler.CreateRestaurant)
+	restaurant.Put("/:restaurantId", admin, r.FoodHandler.UpdateRestaurant)
+	restaurant.Delete("/:restaurantId", admin, r.FoodHandler.DeleteRestaurant)
+	restaurant.Get("/:restaurantId/foods", public, r.FoodHandler.GetFoodsByRestaurantId)
+	restaurant.Get("/:restaurantId/reviews", public, r.ReviewHandler.GetReviewsByRestaurantId)
+	restaurant.Get("/:restaurantId/rating", public, r.ReviewHandler.GetRestaurantRating)
+	restaurant.Get("/:restaurantId/detail", public, r.RestaurantHandler.GetDetail)
+
+	review := f.Group("/review", buffered)
+	review.Get("/:reviewId", public, r.ReviewHandler.GetReview)
+	review.Post("/", user, r.ReviewHandler.CreateReview)
+	review.Put("/:reviewId", user, r.ReviewHandler.UpdateReview)
+	review.Delete("/:reviewId", user, r.ReviewHandler.DeleteReview)
+
+	favorite := f.Group("/favorite", buffered)
+	favorite.Post("/:foodId", user, r.ReviewHandler.AddFavoriteFood)
+	favorite.Delete("/:foodId", user, r.ReviewHandler.RemoveFavoriteFood)
+	favorite.Get("/", user, r.ReviewHandler.GetFavoriteFoodsByUserId)
+
+	me := f.Group("/me", buffered)
+	me.Get("/reviews", user, r.ReviewHandler.GetMyReviews)
+	me.Get("/activity", user, r.ReviewHandler.GetMyActivity)
+
+	foodRecommend := f.Group("/food-recommend", buffered)
+	foodRecommend.Get("/", optional, r.RecommendHandler.GetRecommend)
+	foodRecommend.Get("/swipe", user, r.RecommendHandler.GetSwipeCards)
+	foodRecommend.Post("/swipe", user, r.RecommendHandler.Swipe)
+	foodRecommend.Post("/swipe/undo", user, r.RecommendHandler.UndoSwipe)
+	foodRecommend.Post("/share", user, r.RecommendHandler.ShareRecommendations)
+	foodRecommend.Post("/group", user, r.RecommendHandler.GetGroupRecommend)
+
+	restaurantRecommend := f.Group("/restaurant-recommend", buffered)
+	restaurantRecommend.Get("/", optional, r.RecommendHandler.GetRestaurantRecommend)
 
 	search := f.Group("search")
-	search.Get("/foods", r.SearchHandler.SearchFoods)
-	search.Get("/restaurants", r.SearchHandler.SearchRestaurants)
+	search.Get("/foods", public, r.SearchHandler.SearchFoods)
+	search.Get("/restaurants", public, r.SearchHandler.SearchRestaurants)
 }
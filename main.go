@@ -1,21 +1,52 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/joho/godotenv"
+	"github.com/mummumgoodboy/gateway/internal/api"
 	"github.com/mummumgoodboy/gateway/internal/config"
+	"github.com/mummumgoodboy/gateway/internal/events"
 	"github.com/mummumgoodboy/gateway/internal/handler/auth"
 	"github.com/mummumgoodboy/gateway/internal/handler/food"
+	"github.com/mummumgoodboy/gateway/internal/handler/health"
+	"github.com/mummumgoodboy/gateway/internal/handler/metrics"
 	"github.com/mummumgoodboy/gateway/internal/handler/recommend"
+	"github.com/mummumgoodboy/gateway/internal/handler/restaurant"
 	"github.com/mummumgoodboy/gateway/internal/handler/review"
 	"github.com/mummumgoodboy/gateway/internal/handler/search"
+	"github.com/mummumgoodboy/gateway/internal/interceptor"
+	"github.com/mummumgoodboy/gateway/internal/middleware"
+	"github.com/mummumgoodboy/gateway/internal/popular"
+	"github.com/mummumgoodboy/gateway/internal/profile"
+	"github.com/mummumgoodboy/gateway/internal/rating"
 	"github.com/mummumgoodboy/gateway/internal/route"
+	"github.com/mummumgoodboy/gateway/package/breaker"
+	"github.com/mummumgoodboy/gateway/package/cursor"
+	"github.com/mummumgoodboy/gateway/package/retry"
 	"github.com/mummumgoodboy/gateway/proto"
 	"github.com/mummumgoodboy/verify"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
@@ -32,52 +63,270 @@ func main() {
 		log.Fatal(err)
 	}
 
+	slog.SetDefault(newLogger(cfg.LogConfig))
+
 	verifier, err := verify.NewJWTVerifier(cfg.AuthConfig.Key)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	foodServiceConn, err := grpc.NewClient(cfg.FoodConfig.FoodServiceAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	tracerProvider, err := newTracerProvider(cfg.TracingConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	retryPolicy := newRetryPolicy(cfg.RetryConfig)
+
+	breakers := map[string]*breaker.Breaker{}
+	for _, name := range []string{"food", "review", "recommend", "auth", "search", "profile"} {
+		breakers[name] = newBreaker(cfg.BreakerConfig)
+	}
+
+	foodServiceConn, err := newClientConn(cfg.FoodConfig.FoodServiceAddr, cfg.FoodConfig.FoodServiceTimeout, breakers["food"], retryPolicy)
 	if err != nil {
 		log.Fatal(err)
 	}
 	foodService := proto.NewRestaurantFoodClient(foodServiceConn)
 
-	recommendServiceConn, err := grpc.NewClient(cfg.RecommendConfig.RecommendServiceAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	recommendServiceConn, err := newClientConn(cfg.RecommendConfig.RecommendServiceAddr, cfg.RecommendConfig.RecommendServiceTimeout, breakers["recommend"], retryPolicy)
 	if err != nil {
 		log.Fatal(err)
 	}
 	recommendService := proto.NewRecommendServiceClient(recommendServiceConn)
 
-	reviewServiceConn, err := grpc.NewClient(cfg.ReviewConfig.ReviewServiceAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	reviewServiceConn, err := newClientConn(cfg.ReviewConfig.ReviewServiceAddr, cfg.ReviewConfig.ReviewServiceTimeout, breakers["review"], retryPolicy)
 	if err != nil {
 		log.Fatal(err)
 	}
 	reviewService := proto.NewReviewClient(reviewServiceConn)
 
-	authHandler := auth.NewAuthHandler(&cfg)
-	foodHandler := food.NewFoodHandler(&cfg, foodService, verifier)
-	recommendHandler := recommend.NewRecommendHandler(&cfg, foodService, recommendService, verifier)
-	reviewHandler := review.NewReviewHandler(&cfg, reviewService, foodService, verifier)
-	searchHandler := search.NewSearchHandler(&cfg)
+	emitter := events.NewEmitter(cfg.EventsConfig, recommendService)
+	popularity := popular.NewStore(cfg.FallbackConfig)
+	ratings := rating.NewService(cfg.RatingConfig, reviewService)
+	cursors := cursor.NewSigner(cfg.CursorConfig.Secret)
+
+	authProxy := api.NewProxy("auth", cfg.AuthConfig.AuthServiceTimeout, breakers["auth"], retryPolicy)
+	searchProxy := api.NewProxy("search", cfg.SearchConfig.SearchServiceTimeout, breakers["search"], retryPolicy)
+
+	// Profile lookups break on their own, so that a failing /users endpoint
+	// does not take login and registration down with it.
+	profileProxy := api.NewProxy("profile", cfg.AuthConfig.AuthServiceTimeout, breakers["profile"], retryPolicy)
+	profiles := profile.NewStore(&cfg, profileProxy)
+	if cfg.ProfileConfig.Enabled && cfg.AuthConfig.ServiceToken == "" {
+		slog.Warn("AUTH_SERVICE_TOKEN is not set, reviews are served without reviewer profiles")
+	}
+
+	authHandler := auth.NewAuthHandler(&cfg, authProxy)
+	foodHandler := food.NewFoodHandler(&cfg, foodService, reviewService, emitter, ratings)
+	recommendHandler := recommend.NewRecommendHandler(&cfg, foodService, recommendService, reviewService, popularity, cursors)
+	restaurantHandler := restaurant.NewRestaurantHandler(&cfg, foodService, ratings)
+	reviewHandler := review.NewReviewHandler(&cfg, reviewService, foodService, emitter, popularity, ratings, cursors, profiles)
+	searchHandler := search.NewSearchHandler(&cfg, searchProxy)
+	healthHandler := health.NewHealthHandler(&cfg,
+		health.GRPCDependency("food", foodServiceConn, breakers["food"]),
+		health.GRPCDependency("review", reviewServiceConn, breakers["review"]),
+		health.GRPCDependency("recommend", recommendServiceConn, breakers["recommend"]),
+		health.HTTPDependency("auth", cfg.AuthConfig.AuthServiceURL, breakers["auth"]),
+		health.HTTPDependency("search", cfg.SearchConfig.SearchServiceAddr, breakers["search"]),
+	)
+	metricsHandler := metrics.NewMetricsHandler(prometheus.DefaultGatherer)
+	authMiddleware := middleware.NewAuthMiddleware(verifier)
 	router := route.Route{
-		AuthHandler:      authHandler,
-		FoodHandler:      foodHandler,
-		RecommendHandler: recommendHandler,
-		ReviewHandler:    reviewHandler,
-		SearchHandler:    searchHandler,
+		AuthMiddleware:    authMiddleware,
+		BodyLimit:         cfg.ServerConfig.BodyLimit,
+		AuthHandler:       authHandler,
+		FoodHandler:       foodHandler,
+		HealthHandler:     healthHandler,
+		MetricsHandler:    metricsHandler,
+		RecommendHandler:  recommendHandler,
+		RestaurantHandler: restaurantHandler,
+		ReviewHandler:     reviewHandler,
+		SearchHandler:     searchHandler,
 	}
 
 	corsConfig := cors.Config{
-		AllowOrigins: cfg.CORSConfig.AllowedOrigins,
+		AllowOrigins:  cfg.CORSConfig.AllowedOrigins,
+		ExposeHeaders: strings.Join([]string{api.HeaderNextCursor, api.HeaderTotalCount, api.HeaderPartial, recommend.HeaderFallback}, ","),
 	}
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		BodyLimit: cfg.ServerConfig.BodyLimit,
+		// Lets the auth and search proxies stream request bodies. Every
+		// other route buffers them, see middleware.BufferBody.
+		StreamRequestBody: true,
+	})
 
+	app.Use(middleware.Metrics())
+	app.Use(middleware.Tracing())
+	app.Use(middleware.RequestID())
+	app.Use(middleware.AccessLog())
+	app.Use(recover.New())
 	app.Use(cors.New(corsConfig))
+	app.Use(middleware.Deadline(cfg.TimeoutConfig))
 
 	router.Apply(app)
 
-	log.Println("Gateway is running on port 3000")
-	app.Listen(":3000")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.FallbackConfig.SeedTimeout > 0 {
+		go func() {
+			seedCtx, cancel := context.WithTimeout(ctx, cfg.FallbackConfig.SeedTimeout)
+			defer cancel()
+			if err := popularity.Seed(seedCtx, foodService, reviewService); err != nil {
+				slog.Warn("Failed to seed popular foods", "error", err)
+			}
+		}()
+	}
+
+	go func() {
+		log.Println("Gateway is running on port 3000")
+		if err := app.Listen(":3000"); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	log.Println("Shutting down gateway")
+	if err := app.ShutdownWithTimeout(cfg.ServerConfig.ShutdownTimeout); err != nil {
+		log.Println("Error while draining requests:", err)
+	}
+
+	eventsCtx, cancelEvents := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelEvents()
+	if err := emitter.Shutdown(eventsCtx); err != nil {
+		log.Println("Error sending queued recommender events:", err)
+	}
+
+	closeConns(map[string]*grpc.ClientConn{
+		"food":      foodServiceConn,
+		"recommend": recommendServiceConn,
+		"review":    reviewServiceConn,
+	})
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error flushing traces:", err)
+	}
+
+	log.Println("Gateway stopped")
+	os.Stderr.Sync()
+}
+
+func newLogger(cfg config.LogConfig) *slog.Logger {
+	if cfg.Format == "text" {
+		return slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, nil))
+}
+
+// newTracerProvider samples new traces and follows the decision of inbound
+// ones. With the "none" exporter trace context is still propagated, but spans
+// are dropped.
+func newTracerProvider(cfg config.TracingConfig) (*sdktrace.TracerProvider, error) {
+	res := resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case "none", "":
+		return sdktrace.NewTracerProvider(sdktrace.WithResource(res)), nil
+	case "otlp":
+		var err error
+		exporter, err = otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpointURL(strings.TrimSuffix(cfg.OTLPEndpoint, "/")+"/v1/traces"),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error creating OTLP exporter: %w", err)
+		}
+	case "file":
+		f, err := os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("error opening trace file: %w", err)
+		}
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			return nil, err
+		}
+		exporter = fileExporter{Exporter: stdout, file: f}
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithBatcher(exporter),
+	), nil
+}
+
+// fileExporter writes spans as JSON lines for local development, and closes
+// the file once they are flushed.
+type fileExporter struct {
+	*stdouttrace.Exporter
+	file *os.File
+}
+
+func (e fileExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.Exporter.Shutdown(ctx), e.file.Close())
+}
+
+func newBreaker(cfg config.BreakerConfig) *breaker.Breaker {
+	return breaker.New(breaker.Config{
+		Window:           cfg.Window,
+		MinRequests:      cfg.MinRequests,
+		FailureRate:      cfg.FailureRate,
+		OpenTimeout:      cfg.OpenTimeout,
+		HalfOpenRequests: cfg.HalfOpenRequests,
+		MaxConcurrent:    cfg.MaxConcurrent,
+	})
+}
+
+func newRetryPolicy(cfg config.RetryConfig) retry.Policy {
+	return retry.Policy{
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: cfg.InitialBackoff,
+		MaxBackoff:     cfg.MaxBackoff,
+		Multiplier:     cfg.Multiplier,
+		Jitter:         cfg.Jitter,
+	}
+}
+
+// idempotentMethods are the upstream reads that are safe to retry.
+var idempotentMethods = []string{
+	"/proto.RestaurantFood/GetRestaurants",
+	"/proto.RestaurantFood/GetRestaurantByRestaurantId",
+	"/proto.RestaurantFood/GetFoodsByRestaurantId",
+	"/proto.RestaurantFood/GetFoodByFoodId",
+	"/proto.RestaurantFood/GetFoodsByFoodIds",
+	"/proto.Review/GetReviewsByFoodId",
+	"/proto.Review/GetReviewsByRestaurantId",
+	"/proto.Review/GetReview",
+	"/proto.Review/GetFavoriteFoodsByUserId",
+	"/proto.RecommendService/GetFoodRecommendations",
+}
+
+func newClientConn(addr string, timeout time.Duration, b *breaker.Breaker, rp retry.Policy) (*grpc.ClientConn, error) {
+	return grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(
+			interceptor.Metrics(),
+			interceptor.Tracing(),
+			interceptor.RequestID(),
+			interceptor.CircuitBreaker(b),
+			interceptor.Retry(rp, idempotentMethods...),
+			interceptor.Timeout(timeout),
+		),
+	)
+}
+
+func closeConns(conns map[string]*grpc.ClientConn) {
+	for name, conn := range conns {
+		if err := conn.Close(); err != nil {
+			log.Printf("Error closing %s service connection: %v", name, err)
+		}
+	}
 }
@@ -1,5 +1,10 @@
 package agg
 
+import (
+	"cmp"
+	"slices"
+)
+
 func SortBySlice[K comparable, T any](keys []K, data []T, keyFunc func(T) K) []T {
 	m := make(map[K]T)
 	for _, d := range data {
@@ -15,3 +20,179 @@ func SortBySlice[K comparable, T any](keys []K, data []T, keyFunc func(T) K) []T
 
 	return res
 }
+
+// Diversify re-ranks data, which must be sorted best first, so that groups
+// are spread out. Items beyond maxPerGroup in a group, where zero means no
+// limit, are moved after all the others rather than dropped, so a page cut
+// from the front only holds them when nothing else is left. With interleave,
+// each item is the best remaining one from a different group than the item
+// before it, when there is one; items moved back are interleaved among
+// themselves.
+func Diversify[T any, G comparable](data []T, groupFunc func(T) G, maxPerGroup int, interleave bool) []T {
+	counts := make(map[G]int)
+	kept := make([]T, 0, len(data))
+	var deferred []T
+	for _, d := range data {
+		g := groupFunc(d)
+		if maxPerGroup > 0 && counts[g] >= maxPerGroup {
+			deferred = append(deferred, d)
+			continue
+		}
+		counts[g]++
+		kept = append(kept, d)
+	}
+	if !interleave {
+		return append(kept, deferred...)
+	}
+
+	return append(interleaveGroups(kept, groupFunc), interleaveGroups(deferred, groupFunc)...)
+}
+
+// DiversifyPages arranges data, which must be sorted best first, into pages
+// of pageSize, each the front of what Diversify makes of the items the pages
+// before it left. Items a page moved back thus keep their rank for the next
+// one, and every item is on exactly one page.
+func DiversifyPages[T any, G comparable](data []T, groupFunc func(T) G, pageSize, maxPerGroup int, interleave bool) []T {
+	if pageSize <= 0 {
+		return Diversify(data, groupFunc, maxPerGroup, interleave)
+	}
+
+	rest := make([]int, len(data))
+	for i := range rest {
+		rest[i] = i
+	}
+	res := make([]T, 0, len(data))
+	for len(rest) > 0 {
+		page := Diversify(rest, func(i int) G {
+			return groupFunc(data[i])
+		}, maxPerGroup, interleave)
+		page = page[:min(pageSize, len(page))]
+
+		picked := make(map[int]bool, len(page))
+		for _, i := range page {
+			res = append(res, data[i])
+			picked[i] = true
+		}
+		rest = slices.DeleteFunc(rest, func(i int) bool {
+			return picked[i]
+		})
+	}
+
+	return res
+}
+
+// interleaveGroups reorders data so that each item is the best remaining one
+// from a different group than the item before it, when there is one.
+func interleaveGroups[T any, G comparable](data []T, groupFunc func(T) G) []T {
+	res := make([]T, 0, len(data))
+	for len(data) > 0 {
+		pick := 0
+		if len(res) > 0 {
+			prev := groupFunc(res[len(res)-1])
+			for i, d := range data {
+				if groupFunc(d) != prev {
+					pick = i
+					break
+				}
+			}
+		}
+		res = append(res, data[pick])
+		data = append(data[:pick], data[pick+1:]...)
+	}
+
+	return res
+}
+
+// Borda merges ranked lists by Borda count. In a field of n candidates, an
+// item earns n-r points from a list that ranks it r-th, counting from zero,
+// and nothing from a list that lacks it. Items are returned by total points,
+// ties broken by first appearance.
+func Borda[K comparable](lists [][]K) []K {
+	return aggregate(lists, func(total, points int, first bool) int {
+		return total + points
+	})
+}
+
+// LeastMisery merges ranked lists by the points of the list that likes an
+// item least, so that nobody is served what they ranked low. Points are
+// those of Borda.
+func LeastMisery[K comparable](lists [][]K) []K {
+	return aggregate(lists, func(least, points int, first bool) int {
+		if first {
+			return points
+		}
+		return min(least, points)
+	})
+}
+
+func aggregate[K comparable](lists [][]K, combine func(acc, points int, first bool) int) []K {
+	var order []K
+	seen := make(map[K]bool)
+	for _, list := range lists {
+		for _, k := range list {
+			if !seen[k] {
+				seen[k] = true
+				order = append(order, k)
+			}
+		}
+	}
+
+	n := len(order)
+	scores := make(map[K]int, n)
+	for i, list := range lists {
+		ranks := make(map[K]int, len(list))
+		for r, k := range list {
+			if _, ok := ranks[k]; !ok {
+				ranks[k] = r
+			}
+		}
+		for _, k := range order {
+			points := 0
+			if r, ok := ranks[k]; ok {
+				points = n - r
+			}
+			scores[k] = combine(scores[k], points, i == 0)
+		}
+	}
+
+	slices.SortStableFunc(order, func(a, b K) int {
+		return scores[b] - scores[a]
+	})
+
+	return order
+}
+
+// Unique returns keys without duplicates, keeping first appearances.
+func Unique[K comparable](keys []K) []K {
+	seen := make(map[K]bool, len(keys))
+	res := make([]K, 0, len(keys))
+	for _, k := range keys {
+		if !seen[k] {
+			seen[k] = true
+			res = append(res, k)
+		}
+	}
+
+	return res
+}
+
+// RankGroups ranks the groups of data, which must be sorted best first, by
+// the sum of the reciprocal ranks of their items. A group with several good
+// items can thus beat one with a single better item.
+func RankGroups[T any, G comparable](data []T, groupFunc func(T) G) []G {
+	var order []G
+	scores := make(map[G]float64)
+	for r, d := range data {
+		g := groupFunc(d)
+		if _, ok := scores[g]; !ok {
+			order = append(order, g)
+		}
+		scores[g] += 1 / float64(r+1)
+	}
+
+	slices.SortStableFunc(order, func(a, b G) int {
+		return cmp.Compare(scores[b], scores[a])
+	})
+
+	return order
+}
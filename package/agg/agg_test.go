@@ -0,0 +1,240 @@
+package agg
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// firstLetter groups test items such as "a1" by their letter.
+func firstLetter(s string) byte {
+	return s[0]
+}
+
+func split(s string) []string {
+	return strings.Fields(s)
+}
+
+func TestDiversify(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		maxPerGroup int
+		interleave  bool
+		want        string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "no limit keeps the order",
+			data: "a1 a2 b1 a3",
+			want: "a1 a2 b1 a3",
+		},
+		{
+			name:        "items over the cap move back",
+			data:        "a1 a2 a3 a4 b1 a5 c1 b2 a6 d1",
+			maxPerGroup: 2,
+			want:        "a1 a2 b1 c1 b2 d1 a3 a4 a5 a6",
+		},
+		{
+			name:       "interleave alone",
+			data:       "a1 a2 b1 a3 c1",
+			interleave: true,
+			want:       "a1 b1 a2 c1 a3",
+		},
+		{
+			name:        "interleave kept and moved back items apart",
+			data:        "a1 a2 a3 a4 b1 a5 c1 b2 a6 d1",
+			maxPerGroup: 2,
+			interleave:  true,
+			want:        "a1 b1 a2 c1 b2 d1 a3 a4 a5 a6",
+		},
+		{
+			name:       "single group cannot interleave",
+			data:       "a1 a2 a3",
+			interleave: true,
+			want:       "a1 a2 a3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Diversify(split(tt.data), firstLetter, tt.maxPerGroup, tt.interleave)
+			if want := split(tt.want); !slices.Equal(got, want) {
+				t.Errorf("Diversify() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDiversifyPages(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		pageSize    int
+		maxPerGroup int
+		interleave  bool
+		want        string
+	}{
+		{
+			name:     "empty",
+			pageSize: 2,
+		},
+		{
+			name:        "moved back items lead the next page",
+			data:        "a1 a2 b1 a3 b2",
+			pageSize:    2,
+			maxPerGroup: 1,
+			want:        "a1 b1 a2 b2 a3",
+		},
+		{
+			name:        "cap applies per page",
+			data:        "a1 a2 a3 a4 b1 a5 c1 b2 a6 d1",
+			pageSize:    3,
+			maxPerGroup: 1,
+			want:        "a1 b1 c1 a2 b2 d1 a3 a4 a5 a6",
+		},
+		{
+			name:        "interleaved pages",
+			data:        "a1 a2 a3 b1 b2 c1",
+			pageSize:    4,
+			maxPerGroup: 2,
+			interleave:  true,
+			want:        "a1 b1 a2 b2 a3 c1",
+		},
+		{
+			name:        "no page size diversifies at once",
+			data:        "a1 a2 b1 a3 b2",
+			maxPerGroup: 1,
+			want:        "a1 b1 a2 a3 b2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := split(tt.data)
+			got := DiversifyPages(data, firstLetter, tt.pageSize, tt.maxPerGroup, tt.interleave)
+			if want := split(tt.want); !slices.Equal(got, want) {
+				t.Errorf("DiversifyPages() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// Paging through the arrangement one page at a time must show every item
+// exactly once, which independently diversified pages do not.
+func TestDiversifyPagesCoversEveryItem(t *testing.T) {
+	data := split("a1 a2 a3 b1 a4 b2 c1 a5 b3 a6 c2 d1")
+	for pageSize := 1; pageSize <= len(data); pageSize++ {
+		got := DiversifyPages(data, firstLetter, pageSize, 1, true)
+
+		sorted := slices.Clone(got)
+		slices.Sort(sorted)
+		want := slices.Clone(data)
+		slices.Sort(want)
+		if !slices.Equal(sorted, want) {
+			t.Errorf("page size %d: DiversifyPages() = %v, want a permutation of %v", pageSize, got, data)
+		}
+	}
+}
+
+func TestBorda(t *testing.T) {
+	tests := []struct {
+		name  string
+		lists []string
+		want  string
+	}{
+		{
+			name: "no lists",
+		},
+		{
+			name:  "single list keeps its order",
+			lists: []string{"a b c"},
+			want:  "a b c",
+		},
+		{
+			name:  "ties keep first appearance",
+			lists: []string{"a b c", "c b a"},
+			want:  "a b c",
+		},
+		{
+			name:  "sums the points of every list",
+			lists: []string{"a b c", "b c a", "b a c"},
+			want:  "b a c",
+		},
+		{
+			name:  "partial ranking gives nothing to missing items",
+			lists: []string{"a b c", "b"},
+			want:  "b a c",
+		},
+		{
+			name:  "empty member list",
+			lists: []string{"a b", ""},
+			want:  "a b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lists := make([][]string, len(tt.lists))
+			for i, l := range tt.lists {
+				lists[i] = split(l)
+			}
+
+			if got, want := Borda(lists), split(tt.want); !slices.Equal(got, want) {
+				t.Errorf("Borda() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestLeastMisery(t *testing.T) {
+	tests := []struct {
+		name  string
+		lists []string
+		want  string
+	}{
+		{
+			name: "no lists",
+		},
+		{
+			name:  "single list keeps its order",
+			lists: []string{"a b c"},
+			want:  "a b c",
+		},
+		{
+			name:  "ranks by the least happy member",
+			lists: []string{"a b c", "c b a"},
+			want:  "b a c",
+		},
+		{
+			name:  "ties keep first appearance",
+			lists: []string{"a b", "b a"},
+			want:  "a b",
+		},
+		{
+			name:  "partial ranking leaves missing items last",
+			lists: []string{"a b c", "b"},
+			want:  "b a c",
+		},
+		{
+			name:  "empty member list ties everything",
+			lists: []string{"a b", ""},
+			want:  "a b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lists := make([][]string, len(tt.lists))
+			for i, l := range tt.lists {
+				lists[i] = split(l)
+			}
+
+			if got, want := LeastMisery(lists), split(tt.want); !slices.Equal(got, want) {
+				t.Errorf("LeastMisery() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+// Package breaker implements a circuit breaker combined with a bulkhead that
+// caps concurrent calls.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrOpen is returned while the breaker rejects calls.
+	ErrOpen = errors.New("circuit breaker is open")
+	// ErrBulkheadFull is returned when too many calls are in flight.
+	ErrBulkheadFull = errors.New("too many concurrent calls")
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type Config struct {
+	// Window is the period over which the failure rate is measured.
+	Window time.Duration
+	// MinRequests is the number of calls in a window before the failure
+	// rate is considered.
+	MinRequests int
+	// FailureRate between 0 and 1 that opens the breaker.
+	FailureRate float64
+	// OpenTimeout is how long the breaker stays open before probing.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of probes that must succeed to close
+	// the breaker again.
+	HalfOpenRequests int
+	// MaxConcurrent caps in-flight calls. Zero means no limit.
+	MaxConcurrent int
+}
+
+type Breaker struct {
+	cfg Config
+	sem chan struct{}
+
+	mu          sync.Mutex
+	state       State
+	windowStart time.Time
+	successes   int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	probeOK     int
+}
+
+func New(cfg Config) *Breaker {
+	if cfg.HalfOpenRequests < 1 {
+		cfg.HalfOpenRequests = 1
+	}
+
+	b := &Breaker{cfg: cfg, windowStart: time.Now()}
+	if cfg.MaxConcurrent > 0 {
+		b.sem = make(chan struct{}, cfg.MaxConcurrent)
+	}
+
+	return b
+}
+
+// State returns the current state, moving an open breaker whose timeout has
+// passed to half-open.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+	return b.state
+}
+
+// Allow reserves a call. On success the caller must report the outcome
+// through done exactly once.
+func (b *Breaker) Allow() (done func(success bool), err error) {
+	b.mu.Lock()
+	b.refresh()
+	switch b.state {
+	case StateOpen:
+		b.mu.Unlock()
+		return nil, ErrOpen
+	case StateHalfOpen:
+		if b.probes >= b.cfg.HalfOpenRequests {
+			b.mu.Unlock()
+			return nil, ErrOpen
+		}
+		b.probes++
+	}
+	state := b.state
+	b.mu.Unlock()
+
+	if b.sem != nil {
+		select {
+		case b.sem <- struct{}{}:
+		default:
+			b.cancelProbe(state)
+			return nil, ErrBulkheadFull
+		}
+	}
+
+	var once sync.Once
+	return func(success bool) {
+		once.Do(func() {
+			if b.sem != nil {
+				<-b.sem
+			}
+			b.record(state, success)
+		})
+	}, nil
+}
+
+func (b *Breaker) cancelProbe(state State) {
+	if state != StateHalfOpen {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// refresh expires the measuring window and the open timeout. b.mu must be
+// held.
+func (b *Breaker) refresh() {
+	now := time.Now()
+	switch b.state {
+	case StateClosed:
+		if now.Sub(b.windowStart) >= b.cfg.Window {
+			b.windowStart = now
+			b.successes, b.failures = 0, 0
+		}
+	case StateOpen:
+		if now.Sub(b.openedAt) >= b.cfg.OpenTimeout {
+			b.state = StateHalfOpen
+			b.probes, b.probeOK = 0, 0
+		}
+	}
+}
+
+func (b *Breaker) record(state State, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+	// Outcomes of calls allowed in an earlier state say nothing about the
+	// current one.
+	if b.state != state {
+		return
+	}
+
+	switch b.state {
+	case StateClosed:
+		if success {
+			b.successes++
+		} else {
+			b.failures++
+		}
+		total := b.successes + b.failures
+		if total >= b.cfg.MinRequests && float64(b.failures)/float64(total) >= b.cfg.FailureRate {
+			b.open()
+		}
+	case StateHalfOpen:
+		if !success {
+			b.open()
+			return
+		}
+		b.probeOK++
+		if b.probeOK >= b.cfg.HalfOpenRequests {
+			b.state = StateClosed
+			b.windowStart = time.Now()
+			b.successes, b.failures = 0, 0
+		}
+	}
+}
+
+func (b *Breaker) open() {
+	b.state = StateOpen
+	b.openedAt = time.Now()
+}
@@ -0,0 +1,260 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// tick is both the window and the open timeout of the test breakers.
+const tick = 20 * time.Millisecond
+
+func testConfig() Config {
+	return Config{
+		Window:           tick,
+		MinRequests:      2,
+		FailureRate:      0.5,
+		OpenTimeout:      tick,
+		HalfOpenRequests: 1,
+	}
+}
+
+func call(t *testing.T, b *Breaker, success bool) {
+	t.Helper()
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	done(success)
+}
+
+func TestTransitions(t *testing.T) {
+	tests := []struct {
+		name      string
+		halfOpen  int
+		before    []bool
+		wait      bool
+		after     []bool
+		wantState State
+	}{
+		{
+			name:      "stays closed below min requests",
+			before:    []bool{false},
+			wantState: StateClosed,
+		},
+		{
+			name:      "stays closed below failure rate",
+			before:    []bool{true, true, false},
+			wantState: StateClosed,
+		},
+		{
+			name:      "opens at failure rate",
+			before:    []bool{true, false},
+			wantState: StateOpen,
+		},
+		{
+			name:      "window expiry resets counts",
+			before:    []bool{false},
+			wait:      true,
+			after:     []bool{false},
+			wantState: StateClosed,
+		},
+		{
+			name:      "half-opens after open timeout",
+			before:    []bool{false, false},
+			wait:      true,
+			wantState: StateHalfOpen,
+		},
+		{
+			name:      "closes after probe succeeds",
+			before:    []bool{false, false},
+			wait:      true,
+			after:     []bool{true},
+			wantState: StateClosed,
+		},
+		{
+			name:      "stays half-open until every probe succeeds",
+			halfOpen:  2,
+			before:    []bool{false, false},
+			wait:      true,
+			after:     []bool{true},
+			wantState: StateHalfOpen,
+		},
+		{
+			name:      "closes after every probe succeeds",
+			halfOpen:  2,
+			before:    []bool{false, false},
+			wait:      true,
+			after:     []bool{true, true},
+			wantState: StateClosed,
+		},
+		{
+			name:      "reopens on failed probe",
+			halfOpen:  2,
+			before:    []bool{false, false},
+			wait:      true,
+			after:     []bool{true, false},
+			wantState: StateOpen,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.HalfOpenRequests = tt.halfOpen
+			b := New(cfg)
+
+			for _, success := range tt.before {
+				call(t, b, success)
+			}
+			if tt.wait {
+				time.Sleep(tick + tick/2)
+			}
+			for _, success := range tt.after {
+				call(t, b, success)
+			}
+
+			if got := b.State(); got != tt.wantState {
+				t.Errorf("State() = %v, want %v", got, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestRejectsWhileOpen(t *testing.T) {
+	b := New(testConfig())
+	call(t, b, false)
+	call(t, b, false)
+
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("Allow() error = %v, want %v", err, ErrOpen)
+	}
+}
+
+func TestHalfOpenProbeLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		halfOpen int
+	}{
+		{name: "default", halfOpen: 0},
+		{name: "single probe", halfOpen: 1},
+		{name: "several probes", halfOpen: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.HalfOpenRequests = tt.halfOpen
+			b := New(cfg)
+			call(t, b, false)
+			call(t, b, false)
+			time.Sleep(tick + tick/2)
+
+			probes := max(tt.halfOpen, 1)
+			for i := 0; i < probes; i++ {
+				if _, err := b.Allow(); err != nil {
+					t.Fatalf("probe %d: Allow() error = %v", i+1, err)
+				}
+			}
+			if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+				t.Errorf("Allow() past %d probes error = %v, want %v", probes, err, ErrOpen)
+			}
+		})
+	}
+}
+
+func TestIgnoresOutcomesFromEarlierState(t *testing.T) {
+	b := New(testConfig())
+	stale, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	call(t, b, false)
+	call(t, b, false)
+	time.Sleep(tick + tick/2)
+
+	// Allowed while closed, reported while half-open.
+	stale(true)
+
+	if got := b.State(); got != StateHalfOpen {
+		t.Errorf("State() = %v, want %v", got, StateHalfOpen)
+	}
+}
+
+func TestBulkhead(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxConcurrent int
+		inFlight      int
+		wantErr       error
+	}{
+		{name: "unlimited", maxConcurrent: 0, inFlight: 10},
+		{name: "below limit", maxConcurrent: 3, inFlight: 2},
+		{name: "at limit", maxConcurrent: 3, inFlight: 3, wantErr: ErrBulkheadFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.MaxConcurrent = tt.maxConcurrent
+			b := New(cfg)
+
+			var held []func(bool)
+			for i := 0; i < tt.inFlight; i++ {
+				done, err := b.Allow()
+				if err != nil {
+					t.Fatalf("call %d: Allow() error = %v", i+1, err)
+				}
+				held = append(held, done)
+			}
+
+			done, err := b.Allow()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Allow() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				done(true)
+			}
+
+			// Releasing a slot admits the next call.
+			for _, done := range held {
+				done(true)
+			}
+			if done, err := b.Allow(); err != nil {
+				t.Errorf("Allow() after release error = %v", err)
+			} else {
+				done(true)
+			}
+		})
+	}
+}
+
+func TestBulkheadRejectionFreesProbe(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxConcurrent = 2
+	cfg.HalfOpenRequests = 2
+	b := New(cfg)
+
+	// Holds one slot across the breaker opening and half-opening.
+	if _, err := b.Allow(); err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	call(t, b, false)
+	call(t, b, false)
+	time.Sleep(tick + tick/2)
+
+	first, err := b.Allow()
+	if err != nil {
+		t.Fatalf("first probe: Allow() error = %v", err)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrBulkheadFull) {
+		t.Fatalf("second probe: Allow() error = %v, want %v", err, ErrBulkheadFull)
+	}
+	first(true)
+
+	// The rejected probe must not count against HalfOpenRequests.
+	call(t, b, true)
+	if got := b.State(); got != StateClosed {
+		t.Errorf("State() = %v, want %v", got, StateClosed)
+	}
+}
@@ -0,0 +1,52 @@
+// Package retry computes exponential backoff with jitter between attempts of
+// an idempotent call.
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+type Policy struct {
+	// MaxAttempts counts the first call. One or less disables retries.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction between 0 and 1 by which each backoff is
+	// randomly shortened or lengthened.
+	Jitter float64
+}
+
+// Backoff returns the wait before retry n, counting from 1.
+func (p Policy) Backoff(n int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(max(p.Multiplier, 1), float64(n-1))
+	if p.MaxBackoff > 0 {
+		d = min(d, float64(p.MaxBackoff))
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(d)
+}
+
+// Wait sleeps before retry n and reports whether the retry may be sent. It
+// gives up at once when ctx would expire before the backoff ends.
+func (p Policy) Wait(ctx context.Context, n int) bool {
+	d := p.Backoff(n)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= d {
+		return false
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,117 @@
+package retry
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		n       int
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{
+			name:    "first retry waits the initial backoff",
+			policy:  Policy{InitialBackoff: 100 * time.Millisecond, Multiplier: 2},
+			n:       1,
+			wantMin: 100 * time.Millisecond,
+			wantMax: 100 * time.Millisecond,
+		},
+		{
+			name:    "grows by the multiplier",
+			policy:  Policy{InitialBackoff: 100 * time.Millisecond, Multiplier: 2},
+			n:       3,
+			wantMin: 400 * time.Millisecond,
+			wantMax: 400 * time.Millisecond,
+		},
+		{
+			name:    "capped at max backoff",
+			policy:  Policy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond, Multiplier: 2},
+			n:       5,
+			wantMin: 300 * time.Millisecond,
+			wantMax: 300 * time.Millisecond,
+		},
+		{
+			name:    "multiplier below one keeps the initial backoff",
+			policy:  Policy{InitialBackoff: 100 * time.Millisecond, Multiplier: 0.5},
+			n:       4,
+			wantMin: 100 * time.Millisecond,
+			wantMax: 100 * time.Millisecond,
+		},
+		{
+			name:    "jitter stays within its fraction",
+			policy:  Policy{InitialBackoff: 100 * time.Millisecond, Multiplier: 2, Jitter: 0.2},
+			n:       2,
+			wantMin: 160 * time.Millisecond,
+			wantMax: 240 * time.Millisecond,
+		},
+		{
+			name:    "jitter applies after the cap",
+			policy:  Policy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond, Multiplier: 2, Jitter: 0.5},
+			n:       5,
+			wantMin: 150 * time.Millisecond,
+			wantMax: 450 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Jitter is random, so sample it repeatedly.
+			for i := 0; i < 1000; i++ {
+				got := tt.policy.Backoff(tt.n)
+				if got < tt.wantMin || got > tt.wantMax {
+					t.Fatalf("Backoff(%d) = %v, want between %v and %v", tt.n, got, tt.wantMin, tt.wantMax)
+				}
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	policy := Policy{InitialBackoff: 10 * time.Millisecond, Multiplier: 2}
+
+	tests := []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		want bool
+	}{
+		{
+			name: "waits out the backoff",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			want: true,
+		},
+		{
+			name: "gives up when the deadline is sooner",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 5*time.Millisecond)
+			},
+			want: false,
+		},
+		{
+			name: "gives up when cancelled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			if got := policy.Wait(ctx, 1); got != tt.want {
+				t.Errorf("Wait() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}